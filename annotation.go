@@ -0,0 +1,217 @@
+package biascorr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Gene is a coding sequence of an annotation.
+type Gene struct {
+	Start, End int  // 0-based, half-open.
+	Strand     byte // '+' or '-'.
+	Phase      int
+}
+
+// SiteClassNames lists the supported site classes.
+var SiteClassNames = []string{"all", "coding", "codon1", "codon2", "codon3", "4fold", "intergenic"}
+
+// fourFoldPrefixes are the first two bases of 4-fold degenerate codons.
+var fourFoldPrefixes = map[string]bool{
+	"CT": true, "GT": true, "TC": true, "CC": true,
+	"AC": true, "GC": true, "CG": true, "GG": true,
+}
+
+// ReadGenes reads CDS features from a GFF or GTF file,
+// which must all lie on the same sequence, as genomes are single sequences.
+func ReadGenes(file string) ([]Gene, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	genes := []Gene{}
+	seqid := ""
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		if strings.HasPrefix(line, "##FASTA") {
+			break
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		terms := strings.Split(line, "\t")
+		if len(terms) < 9 {
+			return nil, fmt.Errorf("annotation %s line %d: expected 9 columns, got %d", file, lineNum, len(terms))
+		}
+		if terms[2] != "CDS" {
+			continue
+		}
+		if seqid == "" {
+			seqid = terms[0]
+		} else if terms[0] != seqid {
+			return nil, fmt.Errorf("annotation %s line %d: CDS on sequence %s after %s, but genes must lie on one sequence", file, lineNum, terms[0], seqid)
+		}
+
+		g := Gene{}
+		start, err := strconv.Atoi(terms[3])
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s line %d: bad start %s", file, lineNum, terms[3])
+		}
+		g.End, err = strconv.Atoi(terms[4])
+		if err != nil {
+			return nil, fmt.Errorf("annotation %s line %d: bad end %s", file, lineNum, terms[4])
+		}
+		g.Start = start - 1
+		if terms[6] != "+" && terms[6] != "-" {
+			return nil, fmt.Errorf("annotation %s line %d: bad strand %s", file, lineNum, terms[6])
+		}
+		g.Strand = terms[6][0]
+		if terms[7] != "." {
+			g.Phase, err = strconv.Atoi(terms[7])
+			if err != nil {
+				return nil, fmt.Errorf("annotation %s line %d: bad phase %s", file, lineNum, terms[7])
+			}
+		}
+		genes = append(genes, g)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return genes, nil
+}
+
+// CodonPositions returns the codon position (1, 2 or 3) of every site,
+// and 0 for sites outside coding sequences.
+func CodonPositions(genes []Gene, length int) []int {
+	positions := make([]int, length)
+	for _, g := range genes {
+		for k := g.Start; k < g.End && k < length; k++ {
+			var offset int
+			if g.Strand == '-' {
+				offset = g.End - 1 - g.Phase - k
+			} else {
+				offset = k - g.Start - g.Phase
+			}
+			if offset >= 0 {
+				positions[k] = offset%3 + 1
+			}
+		}
+	}
+	return positions
+}
+
+// isFourFold returns true if the third codon position at site k
+// of the reference genome is 4-fold degenerate.
+func isFourFold(ref string, k int, strand byte) bool {
+	var prefix string
+	if strand == '-' {
+		if k+2 >= len(ref) {
+			return false
+		}
+		prefix = string([]byte{complement(ref[k+2]), complement(ref[k+1])})
+	} else {
+		if k < 2 {
+			return false
+		}
+		prefix = ref[k-2 : k]
+	}
+	return fourFoldPrefixes[strings.ToUpper(prefix)]
+}
+
+// complement returns the complementary nucleotide.
+func complement(b byte) byte {
+	switch b {
+	case 'A', 'a':
+		return 'T'
+	case 'T', 't':
+		return 'A'
+	case 'G', 'g':
+		return 'C'
+	case 'C', 'c':
+		return 'G'
+	}
+	return b
+}
+
+// SiteClassMask returns a mask excluding every site outside the class,
+// one of SiteClassNames, using ref to find 4-fold degenerate sites.
+func SiteClassMask(class string, genes []Gene, ref string) ([]bool, error) {
+	known := false
+	for _, name := range SiteClassNames {
+		known = known || name == class
+	}
+	if !known {
+		return nil, fmt.Errorf("unknown site class %s", class)
+	}
+	length := len(ref)
+	mask := make([]bool, length)
+	if class == "all" {
+		return mask, nil
+	}
+
+	positions := CodonPositions(genes, length)
+	strands := make([]byte, length)
+	for _, g := range genes {
+		for k := g.Start; k < g.End && k < length; k++ {
+			strands[k] = g.Strand
+		}
+	}
+
+	for k := 0; k < length; k++ {
+		var keep bool
+		switch class {
+		case "coding":
+			keep = positions[k] > 0
+		case "codon1":
+			keep = positions[k] == 1
+		case "codon2":
+			keep = positions[k] == 2
+		case "codon3":
+			keep = positions[k] == 3
+		case "4fold":
+			keep = positions[k] == 3 && isFourFold(ref, k, strands[k])
+		case "intergenic":
+			keep = strands[k] == 0
+		}
+		mask[k] = !keep
+	}
+
+	return mask, nil
+}
+
+// GeneBlocks assigns every site to a block: each gene is a block,
+// and so is each intergenic region between genes.
+func GeneBlocks(genes []Gene, length int) []int {
+	blocks := make([]int, length)
+	for k := range blocks {
+		blocks[k] = -1
+	}
+	for i, g := range genes {
+		for k := g.Start; k < g.End && k < length; k++ {
+			blocks[k] = i
+		}
+	}
+
+	next := len(genes)
+	for k := 0; k < length; k++ {
+		if blocks[k] >= 0 {
+			continue
+		}
+		if k > 0 && blocks[k-1] == next-1 && next > len(genes) {
+			blocks[k] = next - 1
+		} else {
+			blocks[k] = next
+			next++
+		}
+	}
+
+	return blocks
+}
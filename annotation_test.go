@@ -0,0 +1,91 @@
+package biascorr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadGenes(t *testing.T) {
+	gff := "##gff-version 3\n" +
+		"chr\t.\tgene\t1\t30\t.\t+\t.\tID=g1\n" +
+		"chr\t.\tCDS\t1\t30\t.\t+\t0\tID=c1\n" +
+		"chr\t.\tCDS\t41\t60\t.\t-\t1\tID=c2\n"
+	file := filepath.Join(t.TempDir(), "a.gff")
+	if err := os.WriteFile(file, []byte(gff), 0644); err != nil {
+		t.Fatal(err)
+	}
+	genes, err := ReadGenes(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Gene{{Start: 0, End: 30, Strand: '+'}, {Start: 40, End: 60, Strand: '-', Phase: 1}}
+	if len(genes) != 2 || genes[0] != want[0] || genes[1] != want[1] {
+		t.Errorf("genes %+v, want %+v", genes, want)
+	}
+
+	noStrand := strings.Replace(gff, "\t-\t1", "\t\t1", 1)
+	if err := os.WriteFile(file, []byte(noStrand), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadGenes(file); err == nil || !strings.Contains(err.Error(), "line 4: bad strand") {
+		t.Errorf("an empty strand was read: %v", err)
+	}
+
+	bad := map[string]string{
+		"unstranded":    strings.Replace(gff, "\t-\t1", "\t.\t1", 1),
+		"eight columns": strings.Replace(gff, "\t1\tID=c2", "\t1", 1),
+		"two sequences": strings.Replace(gff, "chr\t.\tCDS\t41", "plasmid\t.\tCDS\t41", 1),
+	}
+	for name, content := range bad {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ReadGenes(file); err == nil || !strings.Contains(err.Error(), "line 4:") {
+			t.Errorf("%s: genes were read, or reported at another line: %v", name, err)
+		}
+	}
+}
+
+func TestCodonPositions(t *testing.T) {
+	tests := []struct {
+		gene Gene
+		want []int
+	}{
+		{Gene{Start: 1, End: 8, Strand: '+'}, []int{0, 1, 2, 3, 1, 2, 3, 1, 0}},
+		{Gene{Start: 1, End: 8, Strand: '+', Phase: 1}, []int{0, 0, 1, 2, 3, 1, 2, 3, 0}},
+		{Gene{Start: 1, End: 8, Strand: '-'}, []int{0, 1, 3, 2, 1, 3, 2, 1, 0}},
+		{Gene{Start: 1, End: 8, Strand: '-', Phase: 2}, []int{0, 2, 1, 3, 2, 1, 0, 0, 0}},
+		{Gene{Start: 5, End: 12, Strand: '+'}, []int{0, 0, 0, 0, 0, 1, 2, 3, 1}},
+	}
+	for _, tt := range tests {
+		if got := CodonPositions([]Gene{tt.gene}, 9); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: positions %v, want %v", tt.gene, got, tt.want)
+		}
+	}
+}
+
+func TestIsFourFold(t *testing.T) {
+	tests := []struct {
+		ref    string
+		k      int
+		strand byte
+		want   bool
+	}{
+		{"GCT", 2, '+', true},  // GCN, alanine.
+		{"ggA", 2, '+', true},  // lower case.
+		{"ATG", 2, '+', false}, // ATN, isoleucine and methionine.
+		{"GC", 1, '+', false},  // the codon starts before the genome.
+		{"AGC", 0, '-', true},  // GCN on the reverse strand.
+		{"TCC", 0, '-', true},  // GGN, glycine.
+		{"ACA", 0, '-', false}, // TGN, cysteine and tryptophan.
+		{"AG", 0, '-', false},  // the codon ends after the genome.
+	}
+	for _, tt := range tests {
+		if got := isFourFold(tt.ref, tt.k, tt.strand); got != tt.want {
+			t.Errorf("%s site %d strand %c: 4-fold %v, want %v", tt.ref, tt.k, tt.strand, got, tt.want)
+		}
+	}
+}
@@ -1,16 +1,19 @@
-package main
+package biascorr
 
 import (
+	"fmt"
 	"math/rand"
 	"sort"
 )
 
-func biasChoose(p Pop, clusters []int, byCoalTime bool) (genomes []string) {
+// BiasChoose samples a cluster of genomes closest to a random genome
+// for each cluster size.
+func BiasChoose(p Pop, clusters []int, byCoalTime bool, cmp *SiteComparer) (genomes []string) {
 	indices := []int{}
 	for k := 0; k < len(clusters); k++ {
 		sampleSize := clusters[k]
-		central := rand.Intn(len(p.Genomes))
-		distances := calcDistances(p, central, byCoalTime)
+		central := rand.Intn(p.NumGenomes())
+		distances := CalcDistances(p, central, byCoalTime, cmp)
 		tubles := make(Tubles, len(distances))
 		for i := range distances {
 			tubles[i] = Tuble{index: i, value: distances[i]}
@@ -23,73 +26,168 @@ func biasChoose(p Pop, clusters []int, byCoalTime bool) (genomes []string) {
 		}
 	}
 
-	for _, i := range indices {
-		genomes = append(genomes, p.Genomes[i])
+	return p.genomesAt(indices)
+}
+
+// BiasChooseRank returns num clusters of clusterSize genomes,
+// centered on the genomes whose nearest neighbours are closest,
+// by coalescent ranks or by the fraction of differing sites.
+// Clusters have distinct centres, so num must not exceed the genomes.
+func BiasChooseRank(p Pop, clusterSize int, num int, byCoalTime bool, cmp *SiteComparer) ([][]string, error) {
+	indices, err := biasChooseIndices(p, clusterSize, num, byCoalTime, cmp)
+	if err != nil {
+		return nil, err
+	}
+	clusters := [][]string{}
+	for _, cluster := range indices {
+		clusters = append(clusters, p.genomesAt(cluster))
+	}
+	return clusters, nil
+}
+
+// biasChooseIndices returns the genome indices of the clusters
+// of BiasChooseRank.
+func biasChooseIndices(p Pop, clusterSize int, num int, byCoalTime bool, cmp *SiteComparer) ([][]int, error) {
+	if err := checkBiasChoose(p.NumGenomes(), clusterSize, num, byCoalTime, len(p.Ranks)); err != nil {
+		return nil, err
+	}
+	var distance func(i, j int) float64
+	if !byCoalTime {
+		distance = genomeDistance(p, cmp)
+	}
+	totalTubles := Tubles{}
+	for i := 0; i < p.NumGenomes(); i++ {
+		central := i
+		distances := calcDistances(p, central, byCoalTime, distance)
+		tubles := make(Tubles, len(distances))
+		for j := range distances {
+			tubles[j] = Tuble{index: j, value: distances[j]}
+		}
+		sort.Sort(ByValue{tubles})
+
+		totalDistance := 0.0
+		for k := 1; k < clusterSize; k++ {
+			totalDistance += tubles[k].value
+		}
+
+		totalTubles = append(totalTubles, Tuble{index: i, value: totalDistance})
 	}
+	sort.Sort(ByValue{totalTubles})
+
+	clusters := [][]int{}
+	for i := 0; i < num; i++ {
+		indices := []int{}
+		central := totalTubles[i].index
+		tubles := Tubles{}
+		distances := calcDistances(p, central, byCoalTime, distance)
+		for j := range distances {
+			tubles = append(tubles, Tuble{index: j, value: distances[j]})
+		}
+		sort.Sort(ByValue{tubles})
 
-	return
+		for k := 0; k < clusterSize; k++ {
+			indices = append(indices, tubles[k].index)
+		}
+		clusters = append(clusters, indices)
+	}
+
+	return clusters, nil
 }
 
-func biasChooseRank(p Pop, clusterSize int, num int) (clusters [][]string) {
-    totalTubles := Tubles{}
-    for i := 0; i < len(p.Genomes); i++ {
-        central := i
-        distances := calcDistances(p, central, true)
-        tubles := make(Tubles, len(distances))
-        for j := range distances {
-            tubles[j] = Tuble{index: j, value: distances[j]}
-        }
-        sort.Sort(ByValue{tubles})
-
-        totalDistance := 0.0
-        for k := 1; k < clusterSize; k++ {
-            totalDistance += tubles[k].value
-        }
-        
-        totalTubles = append(totalTubles, Tuble{index: i, value: totalDistance})
-    }
-    sort.Sort(ByValue{totalTubles})
-
-    for i := 0; i < num; i++ {
-        genomes := []string{}
-        central := totalTubles[i].index
-        tubles := Tubles{}
-        distances := calcDistances(p, central, true)
-        for j := range distances {
-            tubles = append(tubles, Tuble{index: j, value: distances[j]})
-        }
-        sort.Sort(ByValue{tubles})
-
-        for k := 0; k < clusterSize; k++ {
-            genomes = append(genomes, p.Genomes[tubles[k].index])
-        }
-        clusters = append(clusters, genomes)
-    }
-
-    return
+// checkBiasChoose returns an error unless num clusters of clusterSize
+// genomes can be centred on distinct genomes of n,
+// whose coalescent ranks have the given rows if byCoalTime.
+func checkBiasChoose(n, clusterSize, num int, byCoalTime bool, ranks int) error {
+	switch {
+	case n < clusterSize:
+		return fmt.Errorf("%d genomes are fewer than the cluster size %d", n, clusterSize)
+	case n < num:
+		return fmt.Errorf("%d genomes are fewer than the %d clusters, which are centred on distinct genomes", n, num)
+	case byCoalTime && ranks != n:
+		return fmt.Errorf("no coalescent ranks to cluster by")
+	}
+	return nil
 }
 
-func calcDistances(p Pop, i int, byCoalTime bool) []float64 {
+// ChooseClades returns num clusters, each of every genome in a clade of
+// clusterSize tips of the tree, whose tips are matched to genome names.
+// Clades are drawn at random without replacement until all are used.
+func ChooseClades(p Pop, tree *Tree, clusterSize, num int) ([][]string, error) {
+	indices, err := chooseCladeIndices(p, tree, clusterSize, num)
+	if err != nil {
+		return nil, err
+	}
+	clusters := [][]string{}
+	for _, cluster := range indices {
+		clusters = append(clusters, p.genomesAt(cluster))
+	}
+	return clusters, nil
+}
+
+// chooseCladeIndices returns the genome indices of the clusters
+// of ChooseClades.
+func chooseCladeIndices(p Pop, tree *Tree, clusterSize, num int) ([][]int, error) {
+	clades, err := tree.Clades(p.GenomeNames(), clusterSize)
+	if err != nil {
+		return nil, err
+	}
+	if len(clades) == 0 {
+		return nil, fmt.Errorf("no clade has %d genomes", clusterSize)
+	}
+
+	clusters := [][]int{}
+	var order []int
+	for k := 0; k < num; k++ {
+		if k%len(clades) == 0 {
+			order = rand.Perm(len(clades))
+		}
+		clusters = append(clusters, append([]int{}, clades[order[k%len(clades)]]...))
+	}
+	return clusters, nil
+}
+
+// CalcDistances returns the distances of genome i to all genomes,
+// by coalescent ranks or by the fraction of differing sites.
+func CalcDistances(p Pop, i int, byCoalTime bool, cmp *SiteComparer) []float64 {
+	var distance func(i, j int) float64
+	if !byCoalTime {
+		distance = genomeDistance(p, cmp)
+	}
+	return calcDistances(p, i, byCoalTime, distance)
+}
+
+// calcDistances returns the distances of CalcDistances,
+// given the distance between genomes unless byCoalTime.
+func calcDistances(p Pop, i int, byCoalTime bool, distance func(i, j int) float64) []float64 {
 	distances := []float64{}
-	for j := 0; j < len(p.Genomes); j++ {
+	for j := 0; j < p.NumGenomes(); j++ {
 		if byCoalTime {
 			distances = append(distances, p.Ranks[i][j])
 		} else {
-			distances = append(distances, compareGenomes(p.Genomes[i], p.Genomes[j]))
+			distances = append(distances, distance(i, j))
 		}
 	}
 
 	return distances
 }
 
-func compareGenomes(a, b string) float64 {
+// CompareGenomes returns the fraction of compared sites that differ.
+func CompareGenomes(a, b string, cmp *SiteComparer) float64 {
+	same := make([]bool, len(a))
+	valid := make([]bool, len(a))
+	cmp.Compare(a, b, same, valid)
 	total := 0
+	n := 0
 	for i := 0; i < len(a); i++ {
-		if a[i] != b[i] {
+		if !valid[i] {
+			continue
+		}
+		if !same[i] {
 			total++
 		}
+		n++
 	}
-	return float64(total) / float64(len(a))
+	return float64(total) / float64(n)
 }
 
 // Tuble stores index and value.
@@ -1,16 +1,16 @@
-package main
+package biascorr
 
 import (
 	"math"
 	"sort"
-
-	"bitbucket.org/mingzhi/seqcorr/nuclcov"
 )
 
+// Result is a correlation of one cluster at a lag.
 type Result struct {
 	Lag   int
 	Value float64
 	N     int
+	Sites int // number of site pairs counted, if known.
 	Type  string
 }
 
@@ -38,15 +38,15 @@ func (s BySubPos) Less(i, j int) bool {
 }
 
 func calcCs(genomes []string, maxl int, circular bool) (results []Result) {
-	matrix := [][]*nuclcov.NuclCov{}
+	matrix := [][]*NuclCov{}
 	for _, genome := range genomes {
 		for i := 0; i < len(genome); i++ {
 			for len(matrix) <= i {
-				matrix = append(matrix, []*nuclcov.NuclCov{})
+				matrix = append(matrix, []*NuclCov{})
 			}
 			for lag := 0; lag < maxl; lag++ {
 				for len(matrix[i]) <= lag {
-					matrix[i] = append(matrix[i], nuclcov.New([]byte{'1', '2', '3', '4'}))
+					matrix[i] = append(matrix[i], NewNuclCov([]byte{'1', '2', '3', '4'}))
 				}
 				if !circular && i+lag >= len(genome) {
 					break
@@ -1,85 +1,126 @@
-package main
+package biascorr
 
-func calcP00(ds1, ds2 []bool, maxl int, circular bool) []float64 {
-	pxy := make([]float64, maxl)
-	for l := 0; l < maxl; l++ {
+// CalcP00 returns the fraction of site pairs identical in both comparisons
+// in each lag bin.
+func CalcP00(ds1, ds2, vs1, vs2 []bool, cmp *SiteComparer, bins []LagBin, circular bool) []float64 {
+	pxy := make([]float64, len(bins))
+	for b, bin := range bins {
 		n := 0
-		for i := 0; i < len(ds1); i++ {
-			if !circular && i+l >= len(ds1) {
-				break
-			}
-			x := ds1[i]
-			y := ds2[(i+l)%len(ds1)]
-			if x && y {
-				pxy[l]++
+		for l := bin.Lo; l <= bin.Hi; l++ {
+			for i := 0; i < len(ds1); i++ {
+				j, ok := cmp.Lagged(i, l, len(ds1), circular)
+				if !ok || !vs1[i] || !vs2[j] {
+					continue
+				}
+				x := ds1[i]
+				y := ds2[j]
+				if x && y {
+					pxy[b]++
+				}
+				n++
 			}
-			n++
 		}
-		pxy[l] /= float64(n)
+		pxy[b] /= float64(n)
 	}
 
 	return pxy
 }
 
-func calcPXY(ds1, ds2 []bool, maxl int, circular bool) []float64 {
-	pxy := make([]float64, maxl)
-	for l := 0; l < maxl; l++ {
+// CalcPXY returns the fraction of site pairs differing in both comparisons
+// and the number of site pairs counted in each lag bin.
+func CalcPXY(ds1, ds2, vs1, vs2 []bool, cmp *SiteComparer, bins []LagBin, circular bool) ([]float64, []int) {
+	pxy := make([]float64, len(bins))
+	ns := make([]int, len(bins))
+	for b, bin := range bins {
 		n := 0
-		for i := 0; i < len(ds1); i++ {
-			if !circular && i+l >= len(ds1) {
-				break
-			}
-			x := ds1[i]
-			y := ds2[(i+l)%len(ds1)]
-			if !x && !y {
-				pxy[l]++
+		for l := bin.Lo; l <= bin.Hi; l++ {
+			for i := 0; i < len(ds1); i++ {
+				j, ok := cmp.Lagged(i, l, len(ds1), circular)
+				if !ok || !vs1[i] || !vs2[j] {
+					continue
+				}
+				x := ds1[i]
+				y := ds2[j]
+				if !x && !y {
+					pxy[b]++
+				}
+				n++
 			}
-			n++
 		}
-		pxy[l] /= float64(n)
+		pxy[b] /= float64(n)
+		ns[b] = n
 	}
 
-	return pxy
+	return pxy, ns
+}
+
+// CalcP2 calculates the probability that a pair of genomes differs
+// at both sites in each lag bin (P2), and is identical at both (P0).
+// Closely related genomes are compared by their substitutions,
+// see calcP2Sparse, which gives the same results.
+func CalcP2(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer) (results []Result) {
+	return calcP2(genomes, bins, circular, cmp, nil)
 }
 
-func calcP2(genomes []string, maxl int, circular bool) (results []Result) {
+// calcP2 is CalcP2, taking the valid site pairs of calcP2Sparse
+// from pairs if it is not nil.
+func calcP2(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer, pairs *pairCache) (results []Result) {
+	if sparseComparable(cmp) {
+		subsArr := identifySubs(genomes)
+		if isSparse(subsArr, len(genomes[0])) {
+			return calcP2Sparse(subsArr, nil, len(genomes[0]), bins, circular, cmp, pairs)
+		}
+	}
+	return calcP2Dense(genomes, bins, circular, cmp)
+}
+
+// calcP2Dense calculates P2 and P0 by comparing every site pair.
+func calcP2Dense(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer) (results []Result) {
 	ds := make([]bool, len(genomes[0]))
-	pxy := make([]float64, maxl)
-	p00 := make([]float64, maxl)
+	vs := make([]bool, len(genomes[0]))
+	pxy := make([]float64, len(bins))
+	p00 := make([]float64, len(bins))
+	sites := make([]int, len(bins))
 	n := 0
 	for i := 0; i < len(genomes); i++ {
 		a := genomes[i]
 		for j := i + 1; j < len(genomes); j++ {
 			b := genomes[j]
-			for k := 0; k < len(ds); k++ {
-				ds[k] = a[k] == b[k]
-			}
-			xy := calcPXY(ds, ds, maxl, circular)
-			x0 := calcP00(ds, ds, maxl, circular)
-			for l := 0; l < maxl; l++ {
+			cmp.Compare(a, b, ds, vs)
+			xy, ns := CalcPXY(ds, ds, vs, vs, cmp, bins, circular)
+			x0 := CalcP00(ds, ds, vs, vs, cmp, bins, circular)
+			for l := range bins {
 				pxy[l] += xy[l]
 				p00[l] += x0[l]
+				sites[l] += ns[l]
 			}
 			n++
 		}
 	}
 
-	for l := 0; l < maxl; l++ {
+	return p2Results(bins, pxy, p00, sites, n)
+}
+
+// p2Results averages the P2 and P0 sums of n genome pairs.
+func p2Results(bins []LagBin, pxy, p00 []float64, sites []int, n int) (results []Result) {
+	for l := range bins {
 		pxy[l] /= float64(n)
 		p00[l] /= float64(n)
 	}
 
-	for i := 0; i < maxl; i++ {
+	for i, bin := range bins {
 		res := Result{}
-		res.Lag = i
+		res.Lag = bin.Lo
 		res.N = n
+		res.Sites = sites[i]
 		res.Type = "P2"
 		res.Value = pxy[i]
 		results = append(results, res)
 
 		res = Result{}
-		res.Lag = i
+		res.Lag = bin.Lo
 		res.N = n
+		res.Sites = sites[i]
 		res.Type = "P0"
 		res.Value = p00[i]
 		results = append(results, res)
@@ -88,10 +129,14 @@ func calcP2(genomes []string, maxl int, circular bool) (results []Result) {
 	return
 }
 
-func calcP3(genomes []string, maxl int, circular bool) (results []Result) {
+// CalcP3 calculates P2 from the differences of a genome to two other genomes.
+func CalcP3(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer) (results []Result) {
 	ds1 := make([]bool, len(genomes[0]))
 	ds2 := make([]bool, len(genomes[0]))
-	pxy := make([]float64, maxl)
+	vs1 := make([]bool, len(genomes[0]))
+	vs2 := make([]bool, len(genomes[0]))
+	pxy := make([]float64, len(bins))
+	sites := make([]int, len(bins))
 	n := 0
 	for i := 0; i < len(genomes); i++ {
 		a := genomes[i]
@@ -105,27 +150,27 @@ func calcP3(genomes []string, maxl int, circular bool) (results []Result) {
 					continue
 				}
 				c := genomes[k]
-				for w := 0; w < len(ds1); w++ {
-					ds1[w] = a[w] == b[w]
-					ds2[w] = a[w] == c[w]
-				}
-				xy := calcPXY(ds1, ds2, maxl, circular)
-				for l := 0; l < maxl; l++ {
+				cmp.Compare(a, b, ds1, vs1)
+				cmp.Compare(a, c, ds2, vs2)
+				xy, ns := CalcPXY(ds1, ds2, vs1, vs2, cmp, bins, circular)
+				for l := range bins {
 					pxy[l] += xy[l]
+					sites[l] += ns[l]
 				}
 				n++
 			}
 		}
 	}
 
-	for l := 0; l < maxl; l++ {
+	for l := range bins {
 		pxy[l] /= float64(n)
 	}
 
-	for i := 0; i < maxl; i++ {
+	for i, bin := range bins {
 		res := Result{}
-		res.Lag = i
+		res.Lag = bin.Lo
 		res.N = n
+		res.Sites = sites[i]
 		res.Type = "P3"
 		res.Value = pxy[i]
 		results = append(results, res)
@@ -134,10 +179,14 @@ func calcP3(genomes []string, maxl int, circular bool) (results []Result) {
 	return
 }
 
-func calcP4(genomes []string, maxl int, circular bool) (results []Result) {
+// CalcP4 calculates P2 from the differences of two disjoint pairs of genomes.
+func CalcP4(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer) (results []Result) {
 	ds1 := make([]bool, len(genomes[0]))
 	ds2 := make([]bool, len(genomes[0]))
-	pxy := make([]float64, maxl)
+	vs1 := make([]bool, len(genomes[0]))
+	vs2 := make([]bool, len(genomes[0]))
+	pxy := make([]float64, len(bins))
+	sites := make([]int, len(bins))
 	n := 0
 	for i := 0; i < len(genomes); i++ {
 		a := genomes[i]
@@ -156,13 +205,12 @@ func calcP4(genomes []string, maxl int, circular bool) (results []Result) {
 						continue
 					}
 					d := genomes[h]
-					for w := 0; w < len(ds1); w++ {
-						ds1[w] = a[w] == b[w]
-						ds2[w] = c[w] == d[w]
-					}
-					xy := calcPXY(ds1, ds2, maxl, circular)
-					for l := 0; l < maxl; l++ {
+					cmp.Compare(a, b, ds1, vs1)
+					cmp.Compare(c, d, ds2, vs2)
+					xy, ns := CalcPXY(ds1, ds2, vs1, vs2, cmp, bins, circular)
+					for l := range bins {
 						pxy[l] += xy[l]
+						sites[l] += ns[l]
 					}
 					n++
 				}
@@ -170,14 +218,15 @@ func calcP4(genomes []string, maxl int, circular bool) (results []Result) {
 		}
 	}
 
-	for l := 0; l < maxl; l++ {
+	for l := range bins {
 		pxy[l] /= float64(n)
 	}
 
-	for i := 0; i < maxl; i++ {
+	for i, bin := range bins {
 		res := Result{}
-		res.Lag = i
+		res.Lag = bin.Lo
 		res.N = n
+		res.Sites = sites[i]
 		res.Type = "P4"
 		res.Value = pxy[i]
 		results = append(results, res)
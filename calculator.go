@@ -1,20 +1,73 @@
-package main
+package biascorr
 
+import "fmt"
+import "log"
 import "math"
 import "runtime"
+import "sort"
+import "sync"
 
 // Calculator is a correlation calculator.
 type Calculator struct {
 	Input      chan Pop
 	Output     chan CorrResult
 	Clusters   []int
-	MaxLen     int
+	Lags       []LagBin
 	Repeat     int
 	GenomeLen  int
 	Circular   bool
 	ByCoalTime bool
 	ByRandom   bool
+	ByClade    bool
 	Mix        int
+	Missing    MissingPolicy
+	Mask       []bool
+	LD         bool // also calculate r^2 and D', from genomes built for sparse populations.
+
+	// InferRanks and Tree provide coalescent ranks, see WithRanks.
+	InferRanks RankMethod
+	Tree       *Tree
+
+	// Norms lists normalizations of P2, see NormTypes,
+	// and PlateauBins the number of largest lag bins forming the plateau.
+	Norms       []string
+	PlateauBins int
+
+	// Weighting decides how results are weighted when pooled, see ResultWeight.
+	Weighting string
+
+	// BiasCorrected reports unbiased variances.
+	BiasCorrected bool
+
+	// Distributions keeps a TDigest of each result type and lag in CorrResult.Dist.
+	Distributions bool
+
+	// Genes and SiteClasses restrict correlations to classes of sites,
+	// and WithinGenes restricts lagged pairs to the same gene.
+	Genes       []Gene
+	SiteClasses []string
+	WithinGenes bool
+
+	// Partition, if not nil, keeps lagged pairs within the blocks
+	// of contigs or loci, whose circularity replaces Circular.
+	Partition *Partition
+
+	// Theory enables comparison with the neutral expectation,
+	// whose results are sent to TheoryOutput. Populations of unknown
+	// parameters, see Params.Known, are left out of it.
+	Theory       bool
+	TheoryOutput chan TheoryResult
+	unknownOnce  sync.Once
+
+	// SkipInvalid skips and logs populations that cannot be sampled or
+	// compared, instead of stopping at the first of them, see Err.
+	SkipInvalid bool
+
+	// pairs keeps the valid site pairs of the comparers of every site.
+	pairs *pairCache
+
+	errMu sync.Mutex
+	err   error
 }
 
 // NewCalculator returns a new Calculator.
@@ -22,70 +75,96 @@ func NewCalculator(clusters []int) *Calculator {
 	c := Calculator{}
 	c.Input = make(chan Pop)
 	c.Output = make(chan CorrResult)
+	c.TheoryOutput = make(chan TheoryResult)
 	c.Clusters = clusters
-	c.MaxLen = 100
+	c.Lags = LinearLags(100)
 	c.Repeat = 1
+	c.ByCoalTime = true
 	c.ByRandom = false
 	c.Mix = 0
+	c.Norms = []string{"ks"}
+	c.PlateauBins = 10
+	c.Weighting = "none"
 	return &c
 }
 
 // Calculate calculate correlations.
 func (c *Calculator) Calculate() {
 	resChan := make(chan Result)
+	groupChan := make(chan groupResult)
 	done := make(chan bool)
 	ncpu := runtime.GOMAXPROCS(0)
+	c.pairs = &pairCache{}
 	for i := 0; i < ncpu; i++ {
 		go func() {
 			for p := range c.Input {
-				p2mvs := []*MeanVar{}
-				var clusters [][]string
-				if c.ByRandom {
-					clusters = randChooseClusters(p, c.Clusters[0], c.Repeat)
-				} else {
-					clusters = biasChooseRank(p, c.Clusters[0], c.Repeat)
+				if c.Err() != nil {
+					continue // drain the input after an error.
+				}
+				sampler := c.Sampler()
+				if err := c.Check(p); err != nil {
+					c.fail(err)
+					continue
+				}
+				p, err := sampler.Ranked(p)
+				if err != nil {
+					c.fail(&PopError{Source: p.Source, Index: p.Index, Field: "Ranks", Err: err})
+					continue
+				}
+				clusters, err := sampler.ChooseIndices(p)
+				if err != nil {
+					c.fail(&PopError{Source: p.Source, Index: p.Index, Field: "Genomes", Err: err})
+					continue
+				}
+				comparers, err := c.classComparers(p)
+				if err != nil {
+					c.fail(err)
+					continue
+				}
+				theory := c.Theory && p.Params().Known()
+				if c.Theory && !theory {
+					c.unknownOnce.Do(func() {
+						log.Printf("Leaving populations without simulation parameters, such as those of %s, out of the theory", p.Source)
+					})
 				}
 
-				if c.Mix > 0 && !c.ByRandom {
-					if c.Mix >= c.Clusters[0] {
-						c.Mix = c.Clusters[0] - 1
-					}
-					mixes := randChooseClusters(p, c.Mix, c.Repeat)
+				for _, cc := range comparers {
+					p2mvs := make(map[int]*MeanVar)
 					for k := 0; k < c.Repeat; k++ {
-						for j := 1; j < len(clusters[k]); j++ {
-							clusters[k][j] = mixes[k][j-1]
+						for _, r := range c.clusterCorr(p, clusters[k], cc) {
+							if r.Type == "P2" {
+								if theory && cc.Class == "all" {
+									groupChan <- groupResult{Params: p.Params(), Result: r, Bin: c.lagBin(r.Lag)}
+								}
+								if p2mvs[r.Lag] == nil {
+									p2mvs[r.Lag] = NewMeanVar()
+								}
+								if !math.IsNaN(r.Value) {
+									p2mvs[r.Lag].AddWeighted(r.Value, ResultWeight(r, c.Weighting))
+								}
+							}
+							r.Type = classType(r.Type, cc.Class)
+							resChan <- r
 						}
 					}
-				}
-
-				for k := 0; k < c.Repeat; k++ {
-					genomes := clusters[k]
-					if c.GenomeLen > 0 && c.GenomeLen < len(genomes[0]) {
-						genomes = chopGenomes(genomes, c.GenomeLen)
-						if c.MaxLen > c.GenomeLen {
-							c.MaxLen = c.GenomeLen - 1
+					for _, norm := range c.Norms {
+						normResults, skipped, err := NormalizeP2(p2mvs, c.Lags, norm, c.PlateauBins)
+						if err != nil {
+							log.Printf("Skipping %s of a population (%+v): %v", classType(NormTypes[norm], cc.Class), p.Params(), err)
+							continue
 						}
-					}
-					results := calcCorr(genomes, c.MaxLen, c.Circular)
-					for _, r := range results {
-						resChan <- r
-						if r.Type == "P2" {
-							for len(p2mvs) <= r.Lag {
-								p2mvs = append(p2mvs, NewMeanVar())
+						if skipped > 0 {
+							log.Printf("Skipping %d lag bins of %s of a population (%+v): no P2", skipped, classType(NormTypes[norm], cc.Class), p.Params())
+						}
+						for _, res := range normResults {
+							if theory && cc.Class == "all" && norm == "ks" {
+								groupChan <- groupResult{Params: p.Params(), Result: res, Bin: c.lagBin(res.Lag)}
 							}
-							p2mvs[r.Lag].Add(r.Value)
+							res.Type = classType(res.Type, cc.Class)
+							resChan <- res
 						}
 					}
 				}
-				ks := p2mvs[0].Mean()
-				for l := 0; l < c.MaxLen; l++ {
-					res := Result{}
-					res.Lag = l
-					res.Type = "Pn"
-					res.N = p2mvs[l].N
-					res.Value = p2mvs[l].Mean() / ks
-					resChan <- res
-				}
 			}
 			done <- true
 		}()
@@ -93,15 +172,28 @@ func (c *Calculator) Calculate() {
 
 	go func() {
 		defer close(resChan)
+		defer close(groupChan)
 		for i := 0; i < ncpu; i++ {
 			<-done
 		}
 	}()
 
+	go func() {
+		defer close(c.TheoryOutput)
+		groups, bins := collectGroups(groupChan, c.Weighting)
+		for _, tr := range getTheoryResults(groups, bins) {
+			c.TheoryOutput <- tr
+		}
+	}()
+
 	go func() {
 		defer close(c.Output)
-		resMap := collect(resChan, c.MaxLen)
-		corrResults := getCorrResults(resMap)
+		var digests map[string]map[int]*TDigest
+		if c.Distributions {
+			digests = make(map[string]map[int]*TDigest)
+		}
+		resMap := collect(resChan, c.Weighting, digests)
+		corrResults := getCorrResults(resMap, digests, c.BiasCorrected)
 		for _, cr := range corrResults {
 			c.Output <- cr
 		}
@@ -109,6 +201,166 @@ func (c *Calculator) Calculate() {
 
 }
 
+// Check returns a *PopError if the population cannot be sampled or compared.
+// It serves as Selection.Check, so that such records are skipped or abort
+// reading like invalid ones.
+func (c *Calculator) Check(p Pop) error {
+	if err := c.Sampler().Check(p); err != nil {
+		return err
+	}
+	return c.checkComparers(p)
+}
+
+// checkComparers returns a *PopError if the sites of the population
+// cannot be compared, see classComparers.
+func (c *Calculator) checkComparers(p Pop) error {
+	if c.Partition != nil && c.Partition.Length() > p.GenomeLength() {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Length",
+			Err: fmt.Errorf("the partition of %d sites exceeds the genome length %d", c.Partition.Length(), p.GenomeLength())}
+	}
+	if len(c.SiteClasses) > 0 && p.IsSparse() {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Subs",
+			Err: fmt.Errorf("site classes need genome sequences, not substitutions")}
+	}
+	return nil
+}
+
+// fail skips the population of err, or keeps err to stop calculating,
+// see SkipInvalid.
+func (c *Calculator) fail(err error) {
+	if c.SkipInvalid {
+		log.Printf("Skipping population: %v", err)
+		return
+	}
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// Err returns the error that stopped calculating, if any.
+// The results of Output then omit the populations after it.
+func (c *Calculator) Err() error {
+	c.errMu.Lock()
+	defer c.errMu.Unlock()
+	return c.err
+}
+
+// Sampler returns the Sampler of the first cluster size.
+func (c *Calculator) Sampler() Sampler {
+	return Sampler{
+		ClusterSize: c.Clusters[0],
+		Repeat:      c.Repeat,
+		ByCoalTime:  c.ByCoalTime,
+		ByRandom:    c.ByRandom,
+		ByClade:     c.ByClade,
+		Mix:         c.Mix,
+		Comparer:    NewSiteComparer(c.Missing, c.Mask),
+		Infer:       c.InferRanks,
+		Tree:        c.Tree,
+	}
+}
+
+// lagBin returns the lag bin starting at lag l.
+func (c *Calculator) lagBin(l int) LagBin {
+	for _, bin := range c.Lags {
+		if bin.Lo == l {
+			return bin
+		}
+	}
+	return LagBin{Lo: l, Hi: l}
+}
+
+// clusterCorr returns the correlations of a cluster of genomes,
+// given by their indices. Clusters of sparse populations are compared
+// by their substitutions, unless LD needs genomes.
+func (c *Calculator) clusterCorr(p Pop, cluster []int, cc classComparer) []Result {
+	cmp := cc.SiteComparer
+	length := p.GenomeLength()
+	if c.GenomeLen > 0 && c.GenomeLen < length {
+		length = c.GenomeLen
+	}
+
+	if p.IsSparse() && !c.LD {
+		subsArr := []Subs{}
+		for _, i := range cluster {
+			subs := p.Subs[i]
+			end := sort.Search(len(subs), func(k int) bool { return subs[k].Pos >= length })
+			subsArr = append(subsArr, subs[:end])
+		}
+		return calcP2Sparse(subsArr, p.Ref, length, c.Lags, c.Circular, cmp, cc.pairs)
+	}
+
+	genomes := p.genomesAt(cluster)
+	if length < len(genomes[0]) {
+		genomes = chopGenomes(genomes, length)
+	}
+	results := calcCorr(genomes, c.Lags, c.Circular, cmp, cc.pairs)
+	if c.LD {
+		results = append(results, CalcLD(genomes, c.Lags, c.Circular, cmp)...)
+	}
+	return results
+}
+
+// classComparer is a SiteComparer restricted to a class of sites,
+// with the valid site pairs of its mask, see pairCache.
+type classComparer struct {
+	Class string
+	*SiteComparer
+	pairs *pairCache
+}
+
+// classComparers returns a SiteComparer for each site class of the population.
+func (c *Calculator) classComparers(p Pop) ([]classComparer, error) {
+	if err := c.checkComparers(p); err != nil {
+		return nil, err
+	}
+	var blocks []int
+	if c.WithinGenes {
+		blocks = GeneBlocks(c.Genes, p.GenomeLength())
+	}
+
+	if len(c.SiteClasses) == 0 {
+		cmp := NewSiteComparer(c.Missing, c.Mask)
+		cmp.Blocks = blocks
+		cmp.Partition = c.Partition
+		// the mask is the Calculator's, so its valid pairs are shared.
+		pairs := c.pairs
+		if pairs == nil {
+			pairs = &pairCache{}
+		}
+		return []classComparer{{Class: "all", SiteComparer: cmp, pairs: pairs}}, nil
+	}
+
+	comparers := []classComparer{}
+	for _, class := range c.SiteClasses {
+		mask, err := SiteClassMask(class, c.Genes, p.Genomes[0])
+		if err != nil {
+			return nil, err
+		}
+		for k := range mask {
+			if k < len(c.Mask) && c.Mask[k] {
+				mask[k] = true
+			}
+		}
+		cmp := NewSiteComparer(c.Missing, mask)
+		cmp.Blocks = blocks
+		cmp.Partition = c.Partition
+		// class masks follow the reference of each population.
+		comparers = append(comparers, classComparer{Class: class, SiteComparer: cmp, pairs: &pairCache{}})
+	}
+	return comparers, nil
+}
+
+// classType tags a result type with its site class.
+func classType(t, class string) string {
+	if class == "all" {
+		return t
+	}
+	return t + "_" + class
+}
+
 // chopGenomes
 func chopGenomes(genomes []string, length int) []string {
 	gs := []string{}
@@ -122,48 +374,111 @@ func chopGenomes(genomes []string, length int) []string {
 }
 
 // getCorrResults extract correlation results.
-func getCorrResults(resMap map[string][]*MeanVar) []CorrResult {
+// If digests is not nil, the distributions are kept too.
+func getCorrResults(resMap map[string]map[int]*MeanVar, digests map[string]map[int]*TDigest, biasCorrected bool) []CorrResult {
 	results := []CorrResult{}
 	for t, mvs := range resMap {
-		for i := 0; i < len(mvs); i++ {
-			m := mvs[i].Mean()
-			v := mvs[i].Variance()
-			n := mvs[i].N
-			c := CorrResult{L: i, M: m, V: v, N: n, T: t}
+		for _, l := range sortedLags(mvs) {
+			mvs[l].BiasCorrected = biasCorrected
+			m := mvs[l].Mean()
+			v := mvs[l].Variance()
+			n := mvs[l].N
+			neff := mvs[l].EffectiveN()
+			c := CorrResult{L: l, M: m, V: v, N: n, Neff: neff, T: t, W: mvs[l].W, W2: mvs[l].W2}
+			c.Skew = mvs[l].Skewness()
+			c.Kurt = mvs[l].Kurtosis()
+			if digests != nil {
+				c.Dist = digests[t][l]
+			}
 			results = append(results, c)
 		}
 	}
 	return results
 }
 
+// sortedLags returns the lags of the results in increasing order.
+func sortedLags(mvs map[int]*MeanVar) []int {
+	lags := []int{}
+	for l := range mvs {
+		lags = append(lags, l)
+	}
+	sort.Ints(lags)
+	return lags
+}
+
 // CorrResult stores a correlation result.
 type CorrResult struct {
-	L int
-	M float64
-	V float64
-	N int
-	T string
-	C int
+	L    int
+	M    float64
+	V    float64
+	N    int
+	Neff float64 // effective sample size.
+	Skew float64 // skewness.
+	Kurt float64 // excess kurtosis.
+	W    float64 // sum of weights.
+	W2   float64 // sum of squared weights.
+	T    string
+	C    int
+	Dist *TDigest // distribution, if kept.
+
+	Sweep []string // values of the swept options, see ReadCorrResults.
 }
 
-func calcCorr(genomes []string, maxl int, circular bool) (results []Result) {
-	p2s := calcP2(genomes, maxl, circular)
+func calcCorr(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer, pairs *pairCache) (results []Result) {
+	p2s := calcP2(genomes, bins, circular, cmp, pairs)
 	results = append(results, p2s...)
 
 	return
 }
 
-// collect averages correlation results.
-func collect(resChan chan Result, maxLen int) map[string][]*MeanVar {
-	resMap := make(map[string][]*MeanVar)
+// collect averages correlation results,
+// and adds them to digests if it is not nil.
+func collect(resChan chan Result, weighting string, digests map[string]map[int]*TDigest) map[string]map[int]*MeanVar {
+	resMap := make(map[string]map[int]*MeanVar)
 	for res := range resChan {
-		for len(resMap[res.Type]) <= res.Lag {
-			resMap[res.Type] = append(resMap[res.Type], NewMeanVar())
+		if resMap[res.Type] == nil {
+			resMap[res.Type] = make(map[int]*MeanVar)
+		}
+		if resMap[res.Type][res.Lag] == nil {
+			resMap[res.Type][res.Lag] = NewMeanVar()
+		}
+		if math.IsNaN(res.Value) {
+			continue
 		}
-		if !math.IsNaN(res.Value) {
-			resMap[res.Type][res.Lag].Add(res.Value)
+		w := ResultWeight(res, weighting)
+		resMap[res.Type][res.Lag].AddWeighted(res.Value, w)
+		if digests != nil {
+			if digests[res.Type] == nil {
+				digests[res.Type] = make(map[int]*TDigest)
+			}
+			if digests[res.Type][res.Lag] == nil {
+				digests[res.Type][res.Lag] = NewTDigest(digestCompression)
+			}
+			digests[res.Type][res.Lag].Add(res.Value, w)
 		}
 	}
 
 	return resMap
 }
+
+// digestCompression is the compression of result distributions.
+const digestCompression = 100
+
+// Weightings lists the supported Weightings of results:
+// none gives every result equal weight, pairs weights by the number
+// of genome pairs, and sites by the number of site pairs when known.
+var Weightings = []string{"none", "pairs", "sites"}
+
+// ResultWeight returns the weight of a result.
+func ResultWeight(r Result, weighting string) float64 {
+	switch weighting {
+	case "pairs":
+		return float64(r.N)
+	case "sites":
+		if r.Sites > 0 {
+			return float64(r.Sites)
+		}
+		return float64(r.N)
+	}
+	return 1
+}
@@ -0,0 +1,55 @@
+package biascorr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCalculatorInvalidPops(t *testing.T) {
+	pops := testPops()[:2]
+	for i := range pops {
+		pops[i].Source, pops[i].Index = "pops.json", i
+	}
+	// the second population is shorter than the partition.
+	pt, err := PartitionLengths([]int{3, 3}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// run returns the number of genome pairs at lag 0 and the error.
+	run := func(skip bool) (int, error) {
+		c := NewCalculator([]int{2})
+		c.Lags = LinearLags(2)
+		c.Partition = pt
+		c.SkipInvalid = skip
+		c.Calculate()
+		go func() {
+			defer close(c.Input)
+			for _, p := range pops {
+				c.Input <- p
+			}
+		}()
+		n := 0
+		for res := range c.Output {
+			if res.T == "P2" && res.L == 0 {
+				n = res.N
+			}
+		}
+		return n, c.Err()
+	}
+
+	var perr *PopError
+	if _, err := run(false); !errors.As(err, &perr) || perr.Index != 1 || perr.Field != "Length" {
+		t.Errorf("error %v, want a Length error of population 1", err)
+	}
+	if n, err := run(true); err != nil || n != 1 {
+		t.Errorf("%d pairs and error %v, want the 1 pair of population 0", n, err)
+	}
+
+	if err := (Sampler{ClusterSize: 2, Repeat: 3, ByCoalTime: true}).Check(pops[1]); !errors.As(err, &perr) || perr.Field != "Genomes" {
+		t.Errorf("3 clusters of 2 genomes passed: %v", err)
+	}
+	if _, err := (Sampler{ClusterSize: 2, Repeat: 3, ByCoalTime: true}).ChooseIndices(pops[1]); err == nil {
+		t.Error("3 clusters were centred on 2 genomes")
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	biascorr "github.com/mingzhi/bias_corr"
+	"gopkg.in/yaml.v3"
+)
+
+// corrConfig holds the options of the corr command, keyed as its flags,
+// and a grid of option values to sweep over.
+type corrConfig struct {
+	Input          inputList `yaml:"input"`
+	Output         string    `yaml:"output"`
+	NumPop         int       `yaml:"num_pop"`
+	Skip           int       `yaml:"skip"`
+	Every          int       `yaml:"every"`
+	Filter         string    `yaml:"filter"`
+	Invalid        string    `yaml:"invalid"`
+	RefLength      int       `yaml:"ref_length"`
+	Clusters       int       `yaml:"clusters"`
+	Repeat         int       `yaml:"repeat"`
+	ByCoalTime     bool      `yaml:"by_coal_time"`
+	ByRandom       bool      `yaml:"by_random"`
+	ByClade        bool      `yaml:"by_clade"`
+	Mix            int       `yaml:"mix"`
+	Missing        string    `yaml:"missing"`
+	Mask           string    `yaml:"mask"`
+	Ranks          string    `yaml:"ranks"`
+	Tree           string    `yaml:"tree"`
+	MaxLen         int       `yaml:"maxl"`
+	Lags           string    `yaml:"lags"`
+	LogLags        int       `yaml:"log_lags"`
+	LogBins        bool      `yaml:"log_bins"`
+	Progress       bool      `yaml:"progress"`
+	GenomeLen      int       `yaml:"genome_length"`
+	CircularGenome bool      `yaml:"circular_genome"`
+	NCPU           int       `yaml:"ncpu"`
+	Norms          []string  `yaml:"norm"`
+	PlateauBins    int       `yaml:"plateau_bins"`
+	Weighting      string    `yaml:"weight"`
+	Quantiles      string    `yaml:"quantiles"`
+	Histogram      string    `yaml:"histogram"`
+	HistBins       int       `yaml:"hist_bins"`
+	Digests        string    `yaml:"digests"`
+	Unbiased       bool      `yaml:"unbiased"`
+	LD             bool      `yaml:"ld"`
+	Annotation     string    `yaml:"annotation"`
+	SiteClasses    []string  `yaml:"site_class"`
+	WithinGenes    bool      `yaml:"within_genes"`
+	Partition      string    `yaml:"partition"`
+	Contigs        string    `yaml:"contigs"`
+	Theory         string    `yaml:"theory"`
+
+	// Sweep maps options to lists of values; every combination is run.
+	Sweep yaml.Node `yaml:"sweep,omitempty"`
+}
+
+// inputList is a list of inputs, which may be given as a single input.
+type inputList []string
+
+// UnmarshalYAML decodes a single input or a list of inputs.
+func (l *inputList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = inputList{value.Value}
+		return nil
+	}
+	var inputs []string
+	if err := value.Decode(&inputs); err != nil {
+		return err
+	}
+	*l = inputs
+	return nil
+}
+
+// runOptions cannot be swept, as they concern the whole run.
+var runOptions = map[string]bool{
+	"input": true, "output": true, "num_pop": true, "skip": true, "every": true, "filter": true, "invalid": true, "ref_length": true,
+	"progress": true, "ncpu": true,
+	"quantiles": true, "histogram": true, "digests": true, "theory": true,
+}
+
+// readConfig overlays the options of a YAML file on cfg.
+func readConfig(file string, cfg *corrConfig) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil {
+		return fmt.Errorf("config %s: %v", file, err)
+	}
+	return nil
+}
+
+// writeConfig writes the config as YAML.
+func writeConfig(cfg corrConfig, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	encoder := yaml.NewEncoder(f)
+	defer encoder.Close()
+	return encoder.Encode(cfg)
+}
+
+// validate rejects contradictory options.
+func (cfg corrConfig) validate() error {
+	switch {
+	case cfg.Clusters == 0:
+		return fmt.Errorf("clusters is required")
+	case len(cfg.Input) == 0:
+		return fmt.Errorf("input is required")
+	case cfg.Output == "":
+		return fmt.Errorf("output is required")
+	case cfg.Lags != "" && (cfg.LogLags > 0 || cfg.LogBins):
+		return fmt.Errorf("lags cannot be combined with log_lags or log_bins")
+	case cfg.LogBins && cfg.LogLags == 0:
+		return fmt.Errorf("log_bins requires log_lags")
+	case cfg.GenomeLen < 0:
+		return fmt.Errorf("genome_length must not be negative")
+	case cfg.Annotation == "" && (len(cfg.SiteClasses) > 0 || cfg.WithinGenes):
+		return fmt.Errorf("site_class and within_genes require annotation")
+	case cfg.GenomeLen > 0 && (cfg.Partition != "" || cfg.Contigs != ""):
+		return fmt.Errorf("genome_length cannot be combined with partition or contigs")
+	}
+	if err := validateInputs(cfg.Input); err != nil {
+		return err
+	}
+	if _, err := cfg.selection(); err != nil {
+		return err
+	}
+	if cfg.Lags != "" {
+		if _, err := biascorr.ParseLags(cfg.Lags); err != nil {
+			return fmt.Errorf("lags %s: %v", cfg.Lags, err)
+		}
+	}
+	if _, err := biascorr.ParseMissingPolicy(cfg.Missing); err != nil {
+		return err
+	}
+	if !contains(biascorr.Weightings, cfg.Weighting) {
+		return fmt.Errorf("weight must be one of %s, got %q", strings.Join(biascorr.Weightings, ", "), cfg.Weighting)
+	}
+	for _, norm := range cfg.Norms {
+		if _, ok := biascorr.NormTypes[norm]; !ok {
+			return fmt.Errorf("norm must be one of %s, got %q", strings.Join(biascorr.NormNames, ", "), norm)
+		}
+	}
+	for _, class := range cfg.SiteClasses {
+		if !contains(biascorr.SiteClassNames, class) {
+			return fmt.Errorf("site_class must be one of %s, got %q", strings.Join(biascorr.SiteClassNames, ", "), class)
+		}
+	}
+	if _, err := readPartition(cfg.Partition, cfg.Contigs, cfg.CircularGenome); err != nil {
+		return err
+	}
+	if (cfg.Ranks != "given" || cfg.Tree != "") && (cfg.ByRandom || !(cfg.ByCoalTime || cfg.ByClade)) {
+		return fmt.Errorf("ranks and tree apply only to by_coal_time or by_clade clusters")
+	}
+	method, tree, err := readRanks(cfg.Ranks, cfg.Tree)
+	if err != nil {
+		return err
+	}
+	s := biascorr.Sampler{
+		ClusterSize: cfg.Clusters,
+		Repeat:      cfg.Repeat,
+		ByRandom:    cfg.ByRandom,
+		ByClade:     cfg.ByClade,
+		Mix:         cfg.Mix,
+		Infer:       method,
+		Tree:        tree,
+	}
+	return s.Validate()
+}
+
+// selection returns the Selection of the record options.
+func (cfg corrConfig) selection() (biascorr.Selection, error) {
+	return newSelection(cfg.NumPop, cfg.Skip, cfg.Every, cfg.Filter, cfg.Invalid, cfg.RefLength)
+}
+
+// sweepPoint is a config of one combination of the sweep,
+// with the swept options and their values.
+type sweepPoint struct {
+	cfg    corrConfig
+	keys   []string
+	values []string
+}
+
+// tag returns the values as extra CSV columns.
+func (p sweepPoint) tag() string {
+	return sweepTag(p.values)
+}
+
+// sweepTag returns the values of swept options as extra CSV columns.
+func sweepTag(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return "," + strings.Join(values, ",")
+}
+
+// expand returns the configs of every combination of the sweep,
+// varying the last option fastest.
+func (cfg corrConfig) expand() ([]sweepPoint, error) {
+	sweep := cfg.Sweep
+	cfg.Sweep = yaml.Node{}
+	points := []sweepPoint{{cfg: cfg}}
+	if sweep.IsZero() {
+		return points, nil
+	}
+	if sweep.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("sweep must map options to lists of values")
+	}
+
+	for i := 0; i+1 < len(sweep.Content); i += 2 {
+		key, values := sweep.Content[i].Value, sweep.Content[i+1]
+		if runOptions[key] {
+			return nil, fmt.Errorf("sweep: %s cannot be swept", key)
+		}
+		if values.Kind != yaml.SequenceNode || len(values.Content) == 0 {
+			return nil, fmt.Errorf("sweep: %s must be a non-empty list", key)
+		}
+
+		next := []sweepPoint{}
+		for _, p := range points {
+			for _, v := range values.Content {
+				q, err := p.with(key, v)
+				if err != nil {
+					return nil, err
+				}
+				next = append(next, q)
+			}
+		}
+		points = next
+	}
+
+	return points, nil
+}
+
+// with returns the point with the option key set to value.
+func (p sweepPoint) with(key string, value *yaml.Node) (sweepPoint, error) {
+	var node yaml.Node
+	if err := node.Encode(p.cfg); err != nil {
+		return p, err
+	}
+	found := false
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			node.Content[i+1] = value
+			found = true
+		}
+	}
+	if !found {
+		return p, fmt.Errorf("sweep: unknown option %s", key)
+	}
+
+	q := sweepPoint{}
+	if err := node.Decode(&q.cfg); err != nil {
+		return p, fmt.Errorf("sweep: %s: %v", key, err)
+	}
+	q.keys = append(append([]string{}, p.keys...), key)
+	q.values = append(append([]string{}, p.values...), nodeString(value))
+	return q, nil
+}
+
+// nodeString returns a scalar, or the scalars of a list joined by semicolons.
+func nodeString(n *yaml.Node) string {
+	if n.Kind != yaml.SequenceNode {
+		return n.Value
+	}
+	values := []string{}
+	for _, c := range n.Content {
+		values = append(values, nodeString(c))
+	}
+	return strings.Join(values, ";")
+}
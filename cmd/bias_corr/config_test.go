@@ -0,0 +1,85 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestExpand(t *testing.T) {
+	var cfg corrConfig
+	config := `
+clusters: 5
+repeat: 3
+sweep:
+  clusters: [10, 20]
+  norm: [[ks], [ks, plateau]]
+  circular_genome: [false, true]
+`
+	if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	points, err := cfg.expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 8 {
+		t.Fatalf("%d points, want 8", len(points))
+	}
+
+	// the last option varies fastest.
+	tags := []string{}
+	for _, p := range points {
+		tags = append(tags, p.tag())
+		if !reflect.DeepEqual(p.keys, []string{"clusters", "norm", "circular_genome"}) {
+			t.Errorf("keys %v", p.keys)
+		}
+		if p.cfg.Repeat != 3 || !p.cfg.Sweep.IsZero() {
+			t.Errorf("point %s: repeat %d, sweep %v", p.tag(), p.cfg.Repeat, p.cfg.Sweep.IsZero())
+		}
+	}
+	want := []string{
+		",10,ks,false", ",10,ks,true", ",10,ks;plateau,false", ",10,ks;plateau,true",
+		",20,ks,false", ",20,ks,true", ",20,ks;plateau,false", ",20,ks;plateau,true",
+	}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags %v, want %v", tags, want)
+	}
+	last := points[7].cfg
+	if last.Clusters != 20 || !last.CircularGenome || !reflect.DeepEqual(last.Norms, []string{"ks", "plateau"}) {
+		t.Errorf("last point %+v", last)
+	}
+}
+
+func TestExpandWithoutSweep(t *testing.T) {
+	cfg := corrConfig{Clusters: 5}
+	points, err := cfg.expand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || points[0].tag() != "" || points[0].cfg.Clusters != 5 {
+		t.Errorf("points %+v", points)
+	}
+}
+
+func TestExpandErrors(t *testing.T) {
+	tests := map[string]string{
+		"run option":     "sweep:\n  output: [a.csv, b.csv]\n",
+		"unknown option": "sweep:\n  cluster: [10]\n",
+		"empty list":     "sweep:\n  clusters: []\n",
+		"scalar":         "sweep:\n  clusters: 10\n",
+		"not a mapping":  "sweep: [clusters]\n",
+		"bad value":      "sweep:\n  clusters: [ten]\n",
+	}
+	for name, config := range tests {
+		var cfg corrConfig
+		if err := yaml.Unmarshal([]byte(config), &cfg); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err := cfg.expand(); err == nil || !strings.HasPrefix(err.Error(), "sweep") {
+			t.Errorf("%s: expanded, or without naming the sweep: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	convertCmd       = kingpin.Command("convert", "convert population files between JSON and the binary format")
+	convertInput     = convertCmd.Flag("input", inputHelp).Strings()
+	convertOutput    = convertCmd.Flag("output", "output population file: .bcp for the binary format, otherwise JSON (.gz for gzip)").Required().String()
+	convertSelection = addSelectionFlags(convertCmd)
+)
+
+func init() {
+	convertCmd.Validate(validateConvert)
+}
+
+// validateConvert rejects impossible options of the convert command.
+func validateConvert(*kingpin.CmdClause) error {
+	if err := validateInputs(*convertInput); err != nil {
+		return err
+	}
+	for _, file := range *convertInput {
+		if file == *convertOutput {
+			return fmt.Errorf("--output must differ from --input")
+		}
+	}
+	if _, err := convertSelection.selection(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// convert runs the convert command.
+func convert() {
+	pops := readInputs(*convertInput, mustSelection(convertSelection))
+	if err := biascorr.WritePops(pops, *convertOutput); err != nil {
+		log.Panicf("Error when writing populations: %v", err)
+	}
+}
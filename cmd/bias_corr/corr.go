@@ -0,0 +1,412 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/cheggaaa/pb"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	corrCmd        = kingpin.Command("corr", "calculate correlations of sampled clusters").Default()
+	configFile     = corrCmd.Flag("config", "YAML file of options, overriding the flags, and a sweep grid over them").ExistingFile()
+	input          = corrCmd.Flag("input", inputHelp).Strings()
+	output         = corrCmd.Flag("output", "output").String()
+	selection      = addSelectionFlags(corrCmd)
+	sampling       = addSamplingFlags(corrCmd)
+	maxLen         = corrCmd.Flag("maxl", "max len of correlations").Default("100").IsSetByUser(&maxLenSet).Int()
+	lags           = corrCmd.Flag("lags", "comma-separated lags and lag ranges to average, e.g. 1,2,5,10-19 (overrides --maxl)").String()
+	logLagNum      = corrCmd.Flag("log_lags", "number of log-spaced lags below maxl (0 for every lag)").Default("0").Int()
+	logBins        = corrCmd.Flag("log_bins", "average over all lags between log-spaced lags").Default("false").Bool()
+	showProgress   = corrCmd.Flag("progress", "show progress, out of the populations indexed by binary inputs").Default("false").Bool()
+	genomeLen      = corrCmd.Flag("genome_length", "genome length").Default("0").Int()
+	circularGenome = corrCmd.Flag("circular_genome", "circular genome").Default("false").Bool()
+	ncpu           = corrCmd.Flag("ncpu", "number of CPUs for using").Default("0").Int()
+	norms          = corrCmd.Flag("norm", "normalization of P2 (repeatable): ks (Pn), ks2 (PnKs2), plateau (PnPlateau), cov (PnCov)").Default("ks").Enums(biascorr.NormNames...)
+	plateauBins    = corrCmd.Flag("plateau_bins", "number of largest lag bins averaged as the P2 plateau").Default("10").IsSetByUser(&plateauBinsSet).Int()
+	weighting      = corrCmd.Flag("weight", "weight results when pooling by nothing, genome pairs, or site pairs").Default("none").Enum(biascorr.Weightings...)
+	quantileFile   = corrCmd.Flag("quantiles", "write the 2.5%, 50% and 97.5% quantiles of each type and lag").String()
+	histFile       = corrCmd.Flag("histogram", "write histograms of each type and lag").String()
+	histBins       = corrCmd.Flag("hist_bins", "number of histogram bins").Default("20").IsSetByUser(&histBinsSet).Int()
+	digestFile     = corrCmd.Flag("digests", "write the t-digest of each type and lag, which merge combines into quantiles and histograms").String()
+	unbiased       = corrCmd.Flag("unbiased", "report unbiased (bias-corrected) variances").Default("false").Bool()
+	ld             = corrCmd.Flag("ld", "also calculate linkage disequilibrium r^2 (R2) and D' (Dp), which builds the genomes of sparse VCF or ms input in memory").Default("false").Bool()
+	annotation     = corrCmd.Flag("annotation", "GFF or GTF annotation of coding sequences").String()
+	siteClasses    = corrCmd.Flag("site_class", "restrict to a site class (repeatable): "+strings.Join(biascorr.SiteClassNames, ", ")).Enums(biascorr.SiteClassNames...)
+	withinGenes    = corrCmd.Flag("within_genes", "count lagged pairs only within the same gene or intergenic region").Default("false").Bool()
+	partition      = corrCmd.Flag("partition", "partition file of contigs or loci, as lines like 'DNA, adk = 1-536 [circular]', within which lagged pairs are counted").ExistingFile()
+	contigs        = corrCmd.Flag("contigs", "comma-separated lengths of consecutive contigs or loci, within which lagged pairs are counted, circular if --circular_genome").String()
+	theoryFile     = corrCmd.Flag("theory", "write measured and expected P2 and Pn for each parameter group of simulated populations, leaving out VCF and ms input").String()
+
+	maxLenSet, plateauBinsSet, histBinsSet bool
+)
+
+func init() {
+	corrCmd.Validate(validateCorr)
+}
+
+// validateCorr rejects contradictory options of the corr command,
+// checking every combination of a sweep.
+func validateCorr(*kingpin.CmdClause) error {
+	if *sampling.byRandom && sampling.coalTimeSet {
+		return fmt.Errorf("--by_coal_time does not apply to --by_random sampling")
+	}
+	if *lags != "" && maxLenSet {
+		return fmt.Errorf("--lags cannot be combined with --maxl")
+	}
+	if histBinsSet && *histFile == "" {
+		return fmt.Errorf("--hist_bins requires --histogram")
+	}
+	if plateauBinsSet && !contains(*norms, "plateau") {
+		return fmt.Errorf("--plateau_bins requires --norm plateau")
+	}
+
+	_, points, err := corrPoints()
+	if err != nil {
+		return err
+	}
+	for _, p := range points {
+		if err := p.cfg.validate(); err != nil {
+			if len(p.keys) > 0 {
+				return fmt.Errorf("sweep %s=%s: %v", strings.Join(p.keys, ","), strings.Join(p.values, ","), err)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// flagConfig returns the config of the corr flags.
+func flagConfig() corrConfig {
+	cfg := corrConfig{
+		Input:          *input,
+		Output:         *output,
+		NumPop:         *selection.numPop,
+		Skip:           *selection.skip,
+		Every:          *selection.every,
+		Filter:         *selection.filter,
+		Invalid:        *selection.invalid,
+		RefLength:      *selection.refLength,
+		Repeat:         *sampling.repeat,
+		ByCoalTime:     *sampling.byCoalTime,
+		ByRandom:       *sampling.byRandom,
+		ByClade:        *sampling.byClade,
+		Mix:            *sampling.mix,
+		Missing:        *sampling.missing,
+		Mask:           *sampling.mask,
+		Ranks:          *sampling.ranks,
+		Tree:           *sampling.tree,
+		MaxLen:         *maxLen,
+		Lags:           *lags,
+		LogLags:        *logLagNum,
+		LogBins:        *logBins,
+		Progress:       *showProgress,
+		GenomeLen:      *genomeLen,
+		CircularGenome: *circularGenome,
+		NCPU:           *ncpu,
+		Norms:          *norms,
+		PlateauBins:    *plateauBins,
+		Weighting:      *weighting,
+		Quantiles:      *quantileFile,
+		Histogram:      *histFile,
+		HistBins:       *histBins,
+		Digests:        *digestFile,
+		Unbiased:       *unbiased,
+		LD:             *ld,
+		Annotation:     *annotation,
+		SiteClasses:    *siteClasses,
+		WithinGenes:    *withinGenes,
+		Partition:      *partition,
+		Contigs:        *contigs,
+		Theory:         *theoryFile,
+	}
+	if *sampling.clusters != "" {
+		cfg.Clusters, _ = getClusterSize(*sampling.clusters)
+	}
+	return cfg
+}
+
+// corrPoints returns the config of the flags and the config file,
+// and the configs of its sweep.
+func corrPoints() (corrConfig, []sweepPoint, error) {
+	if *sampling.clusters != "" {
+		if _, err := getClusterSize(*sampling.clusters); err != nil {
+			return corrConfig{}, nil, err
+		}
+	}
+	cfg := flagConfig()
+	if *configFile != "" {
+		if err := readConfig(*configFile, &cfg); err != nil {
+			return cfg, nil, err
+		}
+	}
+	points, err := cfg.expand()
+	return cfg, points, err
+}
+
+// corr runs the corr command.
+func corr() {
+	rand.Seed(time.Now().UTC().UnixNano())
+
+	cfg, points, err := corrPoints()
+	if err != nil {
+		log.Panicf("Error when reading config: %v", err)
+	}
+	if *configFile != "" {
+		if err := writeConfig(cfg, cfg.Output+".config.yaml"); err != nil {
+			log.Panicf("Error when saving config: %v", err)
+		}
+	}
+
+	if cfg.NCPU == 0 {
+		cfg.NCPU = runtime.NumCPU()
+	}
+	runtime.GOMAXPROCS(cfg.NCPU)
+
+	calculators := []*biascorr.Calculator{}
+	for _, p := range points {
+		calculators = append(calculators, newCalculator(p.cfg))
+	}
+
+	// records that any calculator cannot sample, or which its mask does not fit,
+	// are skipped or abort like invalid ones.
+	sel, _ := cfg.selection()
+	sel.Check = func(p biascorr.Pop) error {
+		for i, c := range calculators {
+			if err := c.Check(p); err != nil {
+				return err
+			}
+			if mask := points[i].cfg.Mask; mask != "" {
+				if err := biascorr.CheckMask(mask, c.Mask, p); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	popChan := readInputs(cfg.Input, sel)
+	go func() {
+		defer func() {
+			for _, c := range calculators {
+				close(c.Input)
+			}
+		}()
+
+		var bar *pb.ProgressBar
+		if cfg.Progress {
+			bar = pb.StartNew(progressTotal(cfg.Input, sel))
+			defer bar.Finish()
+		}
+
+		for pop := range popChan {
+			for _, c := range calculators {
+				c.Input <- pop
+			}
+			if cfg.Progress {
+				bar.Increment()
+			}
+		}
+	}()
+
+	for _, c := range calculators {
+		c.Calculate()
+	}
+
+	keys := points[0].keys
+	var dists *distWriter
+	if cfg.Quantiles != "" || cfg.Histogram != "" || cfg.Digests != "" {
+		dists = newDistWriter(cfg.Quantiles, cfg.Histogram, cfg.Digests, cfg.HistBins, keys)
+		defer dists.Close()
+	}
+	w := createCSV(cfg.Output, resultHeader, keys)
+	defer w.Close()
+	for i, c := range calculators {
+		write(c.Output, w, dists, points[i].tag())
+		if err := c.Err(); err != nil {
+			log.Panicf("Error when calculating correlations: %v", err)
+		}
+	}
+
+	if cfg.Theory != "" {
+		w := createCSV(cfg.Theory, "size,mutation_rate,transfer_rate,frag_len,generation,l,m,e,bias,n,t", keys)
+		defer w.Close()
+		for i, c := range calculators {
+			writeTheory(c.TheoryOutput, w, points[i].tag())
+		}
+	}
+}
+
+// newCalculator returns a Calculator of a config.
+func newCalculator(cfg corrConfig) *biascorr.Calculator {
+	c := biascorr.NewCalculator([]int{cfg.Clusters})
+	c.Lags = getLags(cfg.Lags, cfg.MaxLen, cfg.LogLags, cfg.LogBins)
+	c.Repeat = cfg.Repeat
+	c.GenomeLen = cfg.GenomeLen
+	c.Circular = cfg.CircularGenome
+	c.ByCoalTime = cfg.ByCoalTime
+	c.ByRandom = cfg.ByRandom
+	c.ByClade = cfg.ByClade
+	c.Mix = cfg.Mix
+	c.Missing, _ = biascorr.ParseMissingPolicy(cfg.Missing)
+	if cfg.Mask != "" {
+		var err error
+		c.Mask, err = biascorr.ReadMask(cfg.Mask)
+		if err != nil {
+			log.Panicf("Error when reading mask %s: %v", cfg.Mask, err)
+		}
+	}
+	var err error
+	c.InferRanks, c.Tree, err = readRanks(cfg.Ranks, cfg.Tree)
+	if err != nil {
+		log.Panicf("Error when reading ranks: %v", err)
+	}
+	c.LD = cfg.LD
+	c.Norms = cfg.Norms
+	c.PlateauBins = cfg.PlateauBins
+	c.Weighting = cfg.Weighting
+	c.BiasCorrected = cfg.Unbiased
+	c.Distributions = cfg.Quantiles != "" || cfg.Histogram != "" || cfg.Digests != ""
+	c.Theory = cfg.Theory != ""
+	c.SkipInvalid = cfg.Invalid == "skip"
+	if cfg.Annotation != "" {
+		var err error
+		c.Genes, err = biascorr.ReadGenes(cfg.Annotation)
+		if err != nil {
+			log.Panicf("Error when reading annotation %s: %v", cfg.Annotation, err)
+		}
+	}
+	c.SiteClasses = cfg.SiteClasses
+	c.WithinGenes = cfg.WithinGenes
+	c.Partition, err = readPartition(cfg.Partition, cfg.Contigs, cfg.CircularGenome)
+	if err != nil {
+		log.Panicf("Error when reading partition: %v", err)
+	}
+	return c
+}
+
+// readPartition returns the partition of a partition file or of contig lengths,
+// or nil if neither is given.
+func readPartition(file, contigs string, circular bool) (*biascorr.Partition, error) {
+	switch {
+	case file != "" && contigs != "":
+		return nil, fmt.Errorf("give a partition file or contig lengths, not both")
+	case file != "":
+		return biascorr.ReadPartition(file)
+	case contigs != "":
+		lengths := []int{}
+		for _, s := range strings.Split(contigs, ",") {
+			l, err := strconv.Atoi(strings.TrimSpace(s))
+			if err != nil || l < 1 {
+				return nil, fmt.Errorf("bad contig length %q", s)
+			}
+			lengths = append(lengths, l)
+		}
+		return biascorr.PartitionLengths(lengths, circular)
+	}
+	return nil, nil
+}
+
+// getLags returns the lag bins from the command line options.
+func getLags(s string, maxl, logLagNum int, logBins bool) []biascorr.LagBin {
+	if s != "" {
+		bins, err := biascorr.ParseLags(s)
+		if err != nil {
+			log.Panicf("Error when parsing lags %s: %v", s, err)
+		}
+		return bins
+	}
+	if logLagNum > 0 {
+		return biascorr.LogLags(maxl, logLagNum, logBins)
+	}
+	return biascorr.LinearLags(maxl)
+}
+
+// contains returns true if s is in list.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resultHeader names the columns of correlation results. The sums of
+// weights, w and w2, let merge pool weighted results.
+const resultHeader = "l,m,v,n,t,neff,skew,kurt,w,w2"
+
+// createCSV creates a CSV file with the header and extra columns of keys.
+func createCSV(file, header string, keys []string) *os.File {
+	w, err := os.Create(file)
+	if err != nil {
+		panic(err)
+	}
+	w.WriteString(header)
+	for _, k := range keys {
+		w.WriteString("," + k)
+	}
+	w.WriteString("\n")
+	return w
+}
+
+// write the final result with the extra columns of tag,
+// and the distributions if dists is not nil.
+func write(results chan biascorr.CorrResult, w *os.File, dists *distWriter, tag string) {
+	for res := range results {
+		writeResult(w, res, tag)
+		if dists != nil {
+			dists.Write(res, tag)
+		}
+	}
+}
+
+// writeResult writes a result with the extra columns of tag,
+// unless it has no values or variance.
+func writeResult(w *os.File, res biascorr.CorrResult, tag string) {
+	if res.N == 0 || math.IsNaN(res.V) {
+		return
+	}
+	w.WriteString(fmt.Sprintf("%d", res.L))
+	w.WriteString(fmt.Sprintf(",%g,%g", res.M, res.V))
+	w.WriteString(fmt.Sprintf(",%d,%s", res.N, res.T))
+	w.WriteString(fmt.Sprintf(",%g,%g,%g,%g,%g%s\n", res.Neff, res.Skew, res.Kurt, res.W, res.W2, tag))
+}
+
+// writeTheory writes measured correlations next to their expectations.
+func writeTheory(results chan biascorr.TheoryResult, w *os.File, tag string) {
+	for res := range results {
+		if res.N > 0 {
+			w.WriteString(fmt.Sprintf("%d,%g,%g,%d,%d", res.Size, res.MutationRate, res.TransferRate, res.FragLen, res.Generation))
+			w.WriteString(fmt.Sprintf(",%d,%g,%g,%g", res.L, res.M, res.E, res.M-res.E))
+			w.WriteString(fmt.Sprintf(",%d,%s%s\n", res.N, res.T, tag))
+		}
+	}
+}
+
+// progressTotal returns the number of populations selected from the inputs,
+// counted by the indices of binary files, or 0 to show a counter without
+// a total if any input has no index or records are filtered.
+func progressTotal(inputs []string, sel biascorr.Selection) int {
+	files, err := inputFiles(inputs)
+	if err != nil || sel.Filter != nil {
+		return 0
+	}
+	records := 0
+	for _, file := range files {
+		n, err := biascorr.CountBinaryPops(file)
+		if err != nil {
+			return 0
+		}
+		records += n
+	}
+	return sel.Selected(records)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+// distWriter writes quantiles, histograms and digests of result distributions.
+type distWriter struct {
+	quantiles *os.File
+	histogram *os.File
+	digests   *os.File
+	histBins  int
+}
+
+// newDistWriter returns a distWriter writing quantiles to quantileFile,
+// histograms of histBins bins to histFile, and the digests, which merge
+// combines, to digestFile; any file may be empty.
+// keys are the names of extra columns.
+func newDistWriter(quantileFile, histFile, digestFile string, histBins int, keys []string) *distWriter {
+	d := distWriter{histBins: histBins}
+	if quantileFile != "" {
+		d.quantiles = createCSV(quantileFile, "l,t,n,q025,q50,q975", keys)
+	}
+	if histFile != "" {
+		d.histogram = createCSV(histFile, "l,t,lo,hi,count", keys)
+	}
+	if digestFile != "" {
+		d.digests = createCSV(digestFile, "l,t,n,digest", keys)
+	}
+	return &d
+}
+
+// Write writes the distribution of a result with the extra columns of tag.
+func (d *distWriter) Write(res biascorr.CorrResult, tag string) {
+	if res.Dist == nil || res.Dist.Count == 0 {
+		return
+	}
+	if d.quantiles != nil {
+		d.quantiles.WriteString(fmt.Sprintf("%d,%s,%d", res.L, res.T, res.N))
+		d.quantiles.WriteString(fmt.Sprintf(",%g,%g,%g%s\n", res.Dist.Quantile(0.025), res.Dist.Quantile(0.5), res.Dist.Quantile(0.975), tag))
+	}
+	if d.histogram != nil {
+		edges, counts := res.Dist.Histogram(d.histBins)
+		for i := range counts {
+			d.histogram.WriteString(fmt.Sprintf("%d,%s,%g,%g,%g%s\n", res.L, res.T, edges[i], edges[i+1], counts[i], tag))
+		}
+	}
+	if d.digests != nil {
+		text, _ := res.Dist.MarshalText()
+		d.digests.WriteString(fmt.Sprintf("%d,%s,%d,%s%s\n", res.L, res.T, res.N, text, tag))
+	}
+}
+
+// Close closes the files.
+func (d *distWriter) Close() {
+	if d.quantiles != nil {
+		d.quantiles.Close()
+	}
+	if d.histogram != nil {
+		d.histogram.Close()
+	}
+	if d.digests != nil {
+		d.digests.Close()
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	distCmd        = kingpin.Command("distance", "calculate pairwise distances between the genomes of each population")
+	distInput      = distCmd.Flag("input", inputHelp).Strings()
+	distOutput     = distCmd.Flag("output", "output CSV of pop,i,j,d").Required().String()
+	distSelection  = addSelectionFlags(distCmd)
+	distByCoalTime = distCmd.Flag("by_coal_time", "use coalescent ranks instead of the fraction of differing sites").Default("false").Bool()
+	distMissing    = distCmd.Flag("missing", "treat gaps and ambiguous nucleotides as raw bytes, missing data, or differences").Default("raw").IsSetByUser(&distMissingSet).Enum("raw", "ignore", "diff")
+	distMask       = distCmd.Flag("mask", "exclude sites listed in a BED file (.bed) or marked 1 in a per-site 0/1 mask file").String()
+	distRanks      = distCmd.Flag("ranks", rankHelp).Default("given").Enum(biascorr.RankMethodNames...)
+	distTree       = distCmd.Flag("tree", treeHelp).ExistingFile()
+
+	distMissingSet bool
+)
+
+func init() {
+	distCmd.Validate(validateDistance)
+}
+
+// validateDistance rejects contradictory options of the distance command.
+func validateDistance(*kingpin.CmdClause) error {
+	if err := validateInputs(*distInput); err != nil {
+		return err
+	}
+	if *distByCoalTime && *distRanks == "given" && (distMissingSet || *distMask != "") {
+		return fmt.Errorf("--missing and --mask do not apply to given --by_coal_time distances")
+	}
+	if !*distByCoalTime && (*distRanks != "given" || *distTree != "") {
+		return fmt.Errorf("--ranks and --tree require --by_coal_time")
+	}
+	if _, _, err := readRanks(*distRanks, *distTree); err != nil {
+		return err
+	}
+	if _, err := distSelection.selection(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// distance runs the distance command.
+func distance() {
+	policy, err := biascorr.ParseMissingPolicy(*distMissing)
+	if err != nil {
+		kingpin.Fatalf("%v", err)
+	}
+	var mask []bool
+	if *distMask != "" {
+		mask, err = biascorr.ReadMask(*distMask)
+		if err != nil {
+			log.Panicf("Error when reading mask %s: %v", *distMask, err)
+		}
+	}
+	cmp := biascorr.NewSiteComparer(policy, mask)
+	method, tree, err := readRanks(*distRanks, *distTree)
+	if err != nil {
+		log.Panicf("Error when reading ranks: %v", err)
+	}
+
+	w, err := os.Create(*distOutput)
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	// records without ranks to take distances from, or which the mask
+	// does not fit, are skipped or abort like invalid ones.
+	sel := mustSelection(distSelection)
+	sel.Check = func(p biascorr.Pop) error {
+		if *distByCoalTime && len(p.Ranks) == 0 && method == biascorr.RanksGiven && tree == nil {
+			return &biascorr.PopError{Source: p.Source, Index: p.Index, Field: "Ranks", Err: fmt.Errorf("no coalescent ranks")}
+		}
+		if *distMask != "" {
+			return biascorr.CheckMask(*distMask, mask, p)
+		}
+		return nil
+	}
+
+	w.WriteString("pop,i,j,d\n")
+	index := 0
+	for p := range readInputs(*distInput, sel) {
+		if *distByCoalTime {
+			p, err = biascorr.WithRanks(p, method, tree, cmp)
+			if err != nil {
+				if !sel.SkipInvalid {
+					log.Panicf("%s population %d: %v", p.Source, p.Index, err)
+				}
+				log.Printf("Skipping population: %s population %d: %v", p.Source, p.Index, err)
+				continue
+			}
+		}
+		for i := 0; i < p.NumGenomes(); i++ {
+			distances := biascorr.CalcDistances(p, i, *distByCoalTime, cmp)
+			for j := i + 1; j < len(distances); j++ {
+				w.WriteString(fmt.Sprintf("%d,%d,%d,%g\n", index, i, j, distances[j]))
+			}
+		}
+		index++
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	fitCmd         = kingpin.Command("fit", "fit mutation and transfer rates of the neutral expectation to P2")
+	fitInput       = fitCmd.Flag("input", "result file of the corr or merge command").Required().ExistingFile()
+	fitOutput      = fitCmd.Flag("output", "output CSV of the fitted parameters").Required().String()
+	fitProfile     = fitCmd.Flag("profile", "write the measured and fitted P2 of each lag").String()
+	fitType        = fitCmd.Flag("type", "result type to fit, such as P2 or P2_codon3").Default("P2").String()
+	fitSize        = fitCmd.Flag("size", "population size (1 fits rates scaled by the size)").Default("1").Int()
+	fitFragLen     = fitCmd.Flag("frag_len", "transferred fragment length").Default("1000").Int()
+	fitGenerations = fitCmd.Flag("generations", "number of generations since the common ancestor (0 for unbounded)").Default("0").Int()
+)
+
+func init() {
+	fitCmd.Validate(validateFit)
+}
+
+// validateFit rejects impossible options of the fit command.
+func validateFit(*kingpin.CmdClause) error {
+	switch {
+	case *fitSize < 1:
+		return fmt.Errorf("--size must be at least 1")
+	case *fitFragLen < 1:
+		return fmt.Errorf("--frag_len must be at least 1")
+	case *fitGenerations < 0:
+		return fmt.Errorf("--generations must not be negative")
+	}
+	return nil
+}
+
+// fit runs the fit command.
+func fit() {
+	results, keys, err := biascorr.ReadCorrResults(*fitInput)
+	if err != nil {
+		log.Panicf("Error when reading results: %v", err)
+	}
+	if len(keys) > 0 {
+		log.Panicf("Error when reading results: %s has the sweep columns %s; fit the results of one sweep point", *fitInput, strings.Join(keys, ","))
+	}
+
+	par := biascorr.Params{Size: *fitSize, FragLen: *fitFragLen, Generation: *fitGenerations}
+	res, err := biascorr.FitNeutral(results, *fitType, par)
+	if err != nil {
+		log.Panicf("Error when fitting %s: %v", *fitInput, err)
+	}
+
+	w, err := os.Create(*fitOutput)
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	w.WriteString("size,mutation_rate,transfer_rate,frag_len,generation,ks,rss,n,t\n")
+	w.WriteString(fmt.Sprintf("%d,%g,%g,%d,%d", res.Size, res.MutationRate, res.TransferRate, res.FragLen, res.Generation))
+	w.WriteString(fmt.Sprintf(",%g,%g,%d,%s\n", res.Ks, res.RSS, res.N, *fitType))
+
+	if *fitProfile != "" {
+		p, err := os.Create(*fitProfile)
+		if err != nil {
+			panic(err)
+		}
+		defer p.Close()
+
+		p.WriteString("l,m,e,t\n")
+		for _, r := range results {
+			if r.T == *fitType {
+				p.WriteString(fmt.Sprintf("%d,%g,%g,%s\n", r.L, r.M, biascorr.ExpectedP2(res.Params, r.L), r.T))
+			}
+		}
+	}
+}
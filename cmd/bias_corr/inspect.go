@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	inspectCmd       = kingpin.Command("inspect", "summarise the populations of a file")
+	inspectInput     = inspectCmd.Arg("inputs", "population files, read in order (- for stdin, globs allowed, compression detected)").Required().Strings()
+	inspectSelection = addSelectionFlags(inspectCmd)
+	inspectRecord    = inspectCmd.Flag("record", "summarise only this population, read by the index of a binary file").Default("-1").Int()
+)
+
+func init() {
+	inspectCmd.Validate(validateInspect)
+}
+
+// validateInspect rejects impossible options of the inspect command.
+func validateInspect(*kingpin.CmdClause) error {
+	if err := validateInputs(*inspectInput); err != nil {
+		return err
+	}
+	if *inspectRecord >= 0 && len(*inspectInput) != 1 {
+		return fmt.Errorf("--record requires a single input")
+	}
+	if _, err := inspectSelection.selection(); err != nil {
+		return err
+	}
+	if *inspectRecord >= 0 && inspectSelection.isSet() {
+		return fmt.Errorf("--record cannot be combined with --num_pop, --skip, --every or --filter")
+	}
+	return nil
+}
+
+// inspect runs the inspect command, writing a CSV to the standard output.
+// The number of populations in an indexed binary file is logged.
+func inspect() {
+	for _, file := range *inspectInput {
+		if n, err := biascorr.CountBinaryPops(file); err == nil {
+			log.Printf("%s: binary population file with %d indexed populations", file, n)
+		}
+	}
+
+	w := os.Stdout
+	w.WriteString("source,pop,genomes,length,size,mutation_rate,transfer_rate,frag_len,generation,segregating,diversity,missing,ranks\n")
+	if *inspectRecord >= 0 {
+		p, err := biascorr.ReadPopAt((*inspectInput)[0], *inspectRecord)
+		if err != nil {
+			log.Panicf("Error when reading population %d: %v", *inspectRecord, err)
+		}
+		writeSummary(w, p)
+		return
+	}
+
+	for p := range readInputs(*inspectInput, mustSelection(inspectSelection)) {
+		writeSummary(w, p)
+	}
+}
+
+// writeSummary writes the summary of a population.
+func writeSummary(w *os.File, p biascorr.Pop) {
+	s := biascorr.SummarizePop(p)
+	w.WriteString(fmt.Sprintf("%s,%d,%d,%d", p.Source, p.Index, s.Genomes, s.Length))
+	w.WriteString(fmt.Sprintf(",%d,%g,%g,%d,%d", s.Size, s.MutationRate, s.TransferRate, s.FragLen, s.Generation))
+	w.WriteString(fmt.Sprintf(",%d,%g,%g,%t\n", s.Segregating, s.Diversity, s.Missing, s.HasRanks))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+func main() {
+	switch kingpin.Parse() {
+	case corrCmd.FullCommand():
+		corr()
+	case distCmd.FullCommand():
+		distance()
+	case sampleCmd.FullCommand():
+		sample()
+	case simCmd.FullCommand():
+		simulate()
+	case mergeCmd.FullCommand():
+		merge()
+	case fitCmd.FullCommand():
+		fit()
+	case inspectCmd.FullCommand():
+		inspect()
+	case convertCmd.FullCommand():
+		convert()
+	}
+}
+
+// samplingFlags are the options of choosing clusters,
+// shared by the corr and sample commands.
+type samplingFlags struct {
+	clusters   *string
+	repeat     *int
+	byCoalTime *bool
+	byRandom   *bool
+	byClade    *bool
+	mix        *int
+	missing    *string
+	mask       *string
+	ranks      *string
+	tree       *string
+
+	coalTimeSet, missingSet, maskSet bool
+}
+
+// addSamplingFlags adds the sampling options to a command.
+func addSamplingFlags(cmd *kingpin.CmdClause) *samplingFlags {
+	f := samplingFlags{}
+	f.clusters = cmd.Flag("clusters", "cluster size").String()
+	f.repeat = cmd.Flag("repeat", "number of clusters sampled from each population").Default("10").Int()
+	f.byCoalTime = cmd.Flag("by_coal_time", "cluster genomes by coalescent time instead of differing sites, which VCF and ms input without --ranks or --tree fall back to").Default("true").IsSetByUser(&f.coalTimeSet).Bool()
+	f.byRandom = cmd.Flag("by_random", "choose genomes by random instead of by clusters").Default("false").Bool()
+	f.byClade = cmd.Flag("by_clade", "choose every genome of clades of the cluster size, from --tree or a tree built by --ranks").Default("false").Bool()
+	f.mix = cmd.Flag("mix", "replace this many genomes of each cluster by random genomes").Default("0").Int()
+	f.missing = cmd.Flag("missing", "treat gaps and ambiguous nucleotides as raw bytes, missing data, or differences").Default("raw").IsSetByUser(&f.missingSet).Enum("raw", "ignore", "diff")
+	f.mask = cmd.Flag("mask", "exclude sites listed in a BED file (.bed) or marked 1 in a per-site 0/1 mask file").IsSetByUser(&f.maskSet).String()
+	f.ranks = cmd.Flag("ranks", rankHelp).Default("given").Enum(biascorr.RankMethodNames...)
+	f.tree = cmd.Flag("tree", treeHelp).ExistingFile()
+	return &f
+}
+
+// sampler returns the Sampler of the options, reading the mask if given.
+func (f *samplingFlags) sampler() (biascorr.Sampler, error) {
+	size, err := getClusterSize(*f.clusters)
+	if err != nil {
+		return biascorr.Sampler{}, err
+	}
+	policy, err := biascorr.ParseMissingPolicy(*f.missing)
+	if err != nil {
+		return biascorr.Sampler{}, err
+	}
+	var mask []bool
+	if *f.mask != "" {
+		mask, err = biascorr.ReadMask(*f.mask)
+		if err != nil {
+			return biascorr.Sampler{}, fmt.Errorf("reading mask %s: %v", *f.mask, err)
+		}
+	}
+
+	method, tree, err := readRanks(*f.ranks, *f.tree)
+	if err != nil {
+		return biascorr.Sampler{}, err
+	}
+
+	s := biascorr.Sampler{
+		ClusterSize: size,
+		Repeat:      *f.repeat,
+		ByCoalTime:  *f.byCoalTime,
+		ByRandom:    *f.byRandom,
+		ByClade:     *f.byClade,
+		Mix:         *f.mix,
+		Comparer:    biascorr.NewSiteComparer(policy, mask),
+		Infer:       method,
+		Tree:        tree,
+	}
+	return s, nil
+}
+
+// validate rejects contradictory sampling options.
+func (f *samplingFlags) validate() error {
+	if *f.byRandom && f.coalTimeSet {
+		return fmt.Errorf("--by_coal_time does not apply to --by_random sampling")
+	}
+	if *f.byRandom && *f.mix > 0 {
+		return fmt.Errorf("--mix does not apply to --by_random sampling")
+	}
+	if (*f.ranks != "given" || *f.tree != "") && (*f.byRandom || !(*f.byCoalTime || *f.byClade)) {
+		return fmt.Errorf("--ranks and --tree apply only to --by_coal_time or --by_clade clusters")
+	}
+	s, err := f.sampler()
+	if err != nil {
+		return err
+	}
+	return s.Validate()
+}
+
+// rankHelp and treeHelp describe the sources of coalescent ranks.
+const (
+	rankHelp = "coalescent ranks of populations without them: given only, or inferred from a UPGMA or neighbour-joining tree"
+	treeHelp = "take coalescent ranks from a Newick tree whose tips are labelled by genome names, or indices for genomes without names"
+)
+
+// readRanks returns the rank method and the tree of the options.
+func readRanks(ranks, treeFile string) (biascorr.RankMethod, *biascorr.Tree, error) {
+	method, err := biascorr.ParseRankMethod(ranks)
+	if err != nil {
+		return method, nil, err
+	}
+	if treeFile == "" {
+		return method, nil, nil
+	}
+	if method != biascorr.RanksGiven {
+		return method, nil, fmt.Errorf("a tree cannot be combined with inferred ranks")
+	}
+	tree, err := biascorr.ReadNewick(treeFile)
+	if err != nil {
+		return method, nil, fmt.Errorf("reading tree %s: %v", treeFile, err)
+	}
+	return method, tree, nil
+}
+
+// inputHelp describes the population inputs of a command.
+const inputHelp = "input population file, repeatable and read in order (- for stdin, globs allowed, compression detected)"
+
+// inputFiles expands the population inputs.
+// kingpin parses a lone "-" as an empty value, which stands for stdin too.
+func inputFiles(patterns []string) ([]string, error) {
+	inputs := []string{}
+	for _, p := range patterns {
+		if p == "" {
+			p = biascorr.Stdin
+		}
+		inputs = append(inputs, p)
+	}
+	return biascorr.ExpandInputs(inputs)
+}
+
+// validateInputs checks that population inputs exist.
+func validateInputs(patterns []string) error {
+	files, err := inputFiles(patterns)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("--input is required")
+	}
+	stdin := 0
+	for _, file := range files {
+		if file == biascorr.Stdin {
+			stdin++
+		} else if _, err := os.Stat(file); err != nil {
+			return err
+		}
+	}
+	if stdin > 1 {
+		return fmt.Errorf("the standard input can be read only once")
+	}
+	return nil
+}
+
+// selectionFlags are the options of selecting population records,
+// shared by the commands reading populations.
+type selectionFlags struct {
+	numPop    *int
+	skip      *int
+	every     *int
+	filter    *string
+	invalid   *string
+	refLength *int
+}
+
+// addSelectionFlags adds the record selection options to a command.
+func addSelectionFlags(cmd *kingpin.CmdClause) *selectionFlags {
+	f := selectionFlags{}
+	f.numPop = cmd.Flag("num_pop", "number of populations (0 for all)").Default("0").Int()
+	f.skip = cmd.Flag("skip", "skip this many matching populations").Default("0").Int()
+	f.every = cmd.Flag("every", "keep every n-th matching population").Default("1").Int()
+	f.invalid = cmd.Flag("invalid", "abort on invalid population records, or skip them with a warning").Default("abort").Enum("abort", "skip")
+	f.refLength = cmd.Flag("ref_length", "reference length of VCF inputs whose headers lack ##contig lengths, and genome length that ms positions are scaled to").Default("0").Int()
+	f.filter = cmd.Flag("filter", "keep populations matching an expression over Size, Length, MutationRate, TransferRate, FragLen, Generation, Genomes and Index, e.g. 'TransferRate > 1e-4 && Generation >= 10000'").String()
+	return &f
+}
+
+// selection returns the Selection of the options.
+func (f *selectionFlags) selection() (biascorr.Selection, error) {
+	return newSelection(*f.numPop, *f.skip, *f.every, *f.filter, *f.invalid, *f.refLength)
+}
+
+// isSet returns true if any record is excluded by the options.
+func (f *selectionFlags) isSet() bool {
+	return *f.numPop != 0 || *f.skip != 0 || *f.every != 1 || *f.filter != ""
+}
+
+// newSelection returns a validated Selection.
+func newSelection(numPop, skip, every int, filter, invalid string, refLength int) (biascorr.Selection, error) {
+	sel := biascorr.Selection{Max: numPop, Skip: skip, Every: every, SkipInvalid: invalid == "skip", RefLength: refLength}
+	switch {
+	case invalid != "abort" && invalid != "skip":
+		return sel, fmt.Errorf("invalid must be abort or skip, got %s", invalid)
+	case numPop < 0:
+		return sel, fmt.Errorf("num_pop must not be negative")
+	case skip < 0:
+		return sel, fmt.Errorf("skip must not be negative")
+	case every < 1:
+		return sel, fmt.Errorf("every must be at least 1")
+	case refLength < 0:
+		return sel, fmt.Errorf("ref_length must not be negative")
+	}
+	if filter != "" {
+		var err error
+		sel.Filter, err = biascorr.ParseFilter(filter)
+		if err != nil {
+			return sel, err
+		}
+	}
+	return sel, nil
+}
+
+// readInputs reads the selected populations from the inputs in order,
+// and panics once they are read if reading failed.
+func readInputs(patterns []string, sel biascorr.Selection) chan biascorr.Pop {
+	files, err := inputFiles(patterns)
+	if err != nil {
+		log.Panicf("Error when expanding inputs: %v", err)
+	}
+	pops, errc := biascorr.ReadSelectedPops(files, sel)
+	c := make(chan biascorr.Pop)
+	go func() {
+		defer close(c)
+		for p := range pops {
+			c <- p
+		}
+		if err := <-errc; err != nil {
+			log.Panicf("Error when reading populations: %v", err)
+		}
+	}()
+	return c
+}
+
+// mustSelection returns the Selection of validated options.
+func mustSelection(f *selectionFlags) biascorr.Selection {
+	sel, err := f.selection()
+	if err != nil {
+		log.Panicf("Error when reading selection options: %v", err)
+	}
+	return sel
+}
+
+// getClusterSize returns the single cluster size of the --clusters flag.
+func getClusterSize(s string) (int, error) {
+	if s == "" {
+		return 0, fmt.Errorf("--clusters is required")
+	}
+	clusters, err := getClusters(s)
+	if err != nil {
+		return 0, err
+	}
+	if len(clusters) != 1 {
+		return 0, fmt.Errorf("--clusters takes a single cluster size, got %s", s)
+	}
+	return clusters[0], nil
+}
+
+func getClusters(s string) ([]int, error) {
+	terms := strings.Split(s, ",")
+	clusters := []int{}
+	for i := range terms {
+		v, err := strconv.Atoi(terms[i])
+		if err != nil {
+			return nil, fmt.Errorf("bad cluster size %s", terms[i])
+		}
+		clusters = append(clusters, v)
+	}
+	return clusters, nil
+}
+
+// mustSampler returns the Sampler of validated options.
+func mustSampler(f *samplingFlags) biascorr.Sampler {
+	s, err := f.sampler()
+	if err != nil {
+		log.Panicf("Error when reading sampling options: %v", err)
+	}
+	return s
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	mergeCmd      = kingpin.Command("merge", "pool the results of several corr runs")
+	mergeInputs   = mergeCmd.Arg("inputs", "result files of the corr command").Required().ExistingFiles()
+	mergeOutput   = mergeCmd.Flag("output", "output").Required().String()
+	mergeUnbiased = mergeCmd.Flag("unbiased", "the inputs have unbiased variances, and so will the output").Default("false").Bool()
+	mergeDigests  = mergeCmd.Flag("digests", "digest file of the corr command (repeatable), whose distributions are pooled").ExistingFiles()
+	mergeQuantile = mergeCmd.Flag("quantiles", "write the 2.5%, 50% and 97.5% quantiles of the pooled digests").String()
+	mergeHist     = mergeCmd.Flag("histogram", "write histograms of the pooled digests").String()
+	mergeHistBins = mergeCmd.Flag("hist_bins", "number of histogram bins").Default("20").IsSetByUser(&mergeHistBinsSet).Int()
+	mergeDigestTo = mergeCmd.Flag("digest_output", "write the pooled digests, to be merged further").String()
+
+	mergeHistBinsSet bool
+)
+
+func init() {
+	mergeCmd.Validate(validateMerge)
+}
+
+// validateMerge rejects contradictory options of the merge command.
+func validateMerge(*kingpin.CmdClause) error {
+	for _, file := range append(append([]string{}, *mergeInputs...), *mergeDigests...) {
+		for _, out := range []string{*mergeOutput, *mergeQuantile, *mergeHist, *mergeDigestTo} {
+			if file == out {
+				return fmt.Errorf("output %s is also an input", file)
+			}
+		}
+	}
+	distOut := *mergeQuantile != "" || *mergeHist != "" || *mergeDigestTo != ""
+	switch {
+	case len(*mergeDigests) > 0 && !distOut:
+		return fmt.Errorf("--digests requires --quantiles, --histogram or --digest_output")
+	case len(*mergeDigests) == 0 && distOut:
+		return fmt.Errorf("--quantiles, --histogram and --digest_output require --digests")
+	case mergeHistBinsSet && *mergeHist == "":
+		return fmt.Errorf("--hist_bins requires --histogram")
+	}
+	return nil
+}
+
+// merge runs the merge command.
+func merge() {
+	results := []biascorr.CorrResult{}
+	var keys []string
+	for i, file := range *mergeInputs {
+		rs, ks, err := biascorr.ReadCorrResults(file)
+		if err != nil {
+			log.Panicf("Error when reading results: %v", err)
+		}
+		if i == 0 {
+			keys = ks
+		} else if strings.Join(ks, ",") != strings.Join(keys, ",") {
+			log.Panicf("Error when reading results: %s has sweep columns [%s], but %s has [%s]", file, strings.Join(ks, ","), (*mergeInputs)[0], strings.Join(keys, ","))
+		}
+		results = append(results, rs...)
+	}
+
+	w := createCSV(*mergeOutput, resultHeader, keys)
+	defer w.Close()
+	for _, res := range biascorr.MergeCorrResults(results, *mergeUnbiased) {
+		writeResult(w, res, sweepTag(res.Sweep))
+	}
+
+	if len(*mergeDigests) > 0 {
+		mergeDists(keys)
+	}
+}
+
+// mergeDists pools the digests of the merge command,
+// whose sweep columns must be keys.
+func mergeDists(keys []string) {
+	results := []biascorr.CorrResult{}
+	for _, file := range *mergeDigests {
+		rs, ks, err := biascorr.ReadDigests(file)
+		if err != nil {
+			log.Panicf("Error when reading digests: %v", err)
+		}
+		if strings.Join(ks, ",") != strings.Join(keys, ",") {
+			log.Panicf("Error when reading digests: %s has sweep columns [%s], but the results have [%s]", file, strings.Join(ks, ","), strings.Join(keys, ","))
+		}
+		results = append(results, rs...)
+	}
+
+	dists := newDistWriter(*mergeQuantile, *mergeHist, *mergeDigestTo, *mergeHistBins, keys)
+	defer dists.Close()
+	for _, res := range biascorr.MergeDigests(results) {
+		dists.Write(res, sweepTag(res.Sweep))
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	sampleCmd       = kingpin.Command("sample", "write sampled clusters as FASTA or JSON populations")
+	sampleInput     = sampleCmd.Flag("input", inputHelp).Strings()
+	sampleOutput    = sampleCmd.Flag("output", "output file (.gz for gzipped JSON)").Required().String()
+	sampleSelection = addSelectionFlags(sampleCmd)
+	sampleFormat    = sampleCmd.Flag("format", "output format: fasta, or json with one population per cluster").Default("fasta").Enum("fasta", "json")
+	sampleSeed      = sampleCmd.Flag("seed", "random seed (0 for current time)").Default("0").Int64()
+	sampleSampling  = addSamplingFlags(sampleCmd)
+)
+
+func init() {
+	sampleCmd.Validate(validateSample)
+}
+
+// validateSample rejects contradictory options of the sample command.
+func validateSample(*kingpin.CmdClause) error {
+	if err := validateInputs(*sampleInput); err != nil {
+		return err
+	}
+	if err := sampleSampling.validate(); err != nil {
+		return err
+	}
+	if *sampleSampling.byCoalTime && !*sampleSampling.byRandom && *sampleSampling.ranks == "given" && (sampleSampling.missingSet || sampleSampling.maskSet) {
+		return fmt.Errorf("--missing and --mask only apply to clusters by differing sites or inferred ranks, use --no-by_coal_time or --ranks")
+	}
+	if *sampleFormat == "fasta" && strings.HasSuffix(*sampleOutput, ".gz") {
+		return fmt.Errorf("gzipped output requires --format json")
+	}
+	if _, err := sampleSelection.selection(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// sample runs the sample command.
+func sample() {
+	seed := *sampleSeed
+	if seed == 0 {
+		seed = time.Now().UTC().UnixNano()
+	}
+	rand.Seed(seed)
+
+	s := mustSampler(sampleSampling)
+	sel := mustSelection(sampleSelection)
+	sel.Check = func(p biascorr.Pop) error {
+		if err := s.Check(p); err != nil {
+			return err
+		}
+		if *sampleSampling.mask != "" {
+			if err := biascorr.CheckMask(*sampleSampling.mask, s.Comparer.Mask, p); err != nil {
+				return err
+			}
+		}
+		if *sampleFormat == "fasta" && p.IsSparse() {
+			return &biascorr.PopError{Source: p.Source, Index: p.Index, Field: "Subs", Err: fmt.Errorf("FASTA output needs genome sequences, not substitutions")}
+		}
+		return nil
+	}
+	pops := readInputs(*sampleInput, sel)
+	if *sampleFormat == "json" {
+		clusters := make(chan biascorr.Pop)
+		go func() {
+			defer close(clusters)
+			for p := range pops {
+				for _, cluster := range choose(s, p, sel.SkipInvalid) {
+					clusters <- p.Cluster(cluster)
+				}
+			}
+		}()
+		if err := biascorr.WritePops(clusters, *sampleOutput); err != nil {
+			log.Panicf("Error when writing populations: %v", err)
+		}
+		return
+	}
+
+	w, err := os.Create(*sampleOutput)
+	if err != nil {
+		panic(err)
+	}
+	defer w.Close()
+
+	index := 0
+	for p := range pops {
+		for k, cluster := range choose(s, p, sel.SkipInvalid) {
+			for i, j := range cluster {
+				w.WriteString(fmt.Sprintf(">pop%d_cluster%d_%d\n%s\n", index, k, i, p.Genomes[j]))
+			}
+		}
+		index++
+	}
+}
+
+// choose returns the genome indices of the clusters of a population,
+// which passed Sampler.Check while read, ranking it if needed.
+// Populations that cannot be ranked or clustered are skipped with
+// a warning if skipInvalid, and abort otherwise.
+func choose(s biascorr.Sampler, p biascorr.Pop, skipInvalid bool) [][]int {
+	p, err := s.Ranked(p)
+	if err == nil {
+		var clusters [][]int
+		if clusters, err = s.ChooseIndices(p); err == nil {
+			return clusters
+		}
+	}
+	if !skipInvalid {
+		log.Panicf("%s population %d: %v", p.Source, p.Index, err)
+	}
+	log.Printf("Skipping population: %s population %d: %v", p.Source, p.Index, err)
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	biascorr "github.com/mingzhi/bias_corr"
+)
+
+var (
+	simCmd          = kingpin.Command("simulate", "simulate populations with mutation and fragment transfer")
+	simOutput       = simCmd.Flag("output", "output population file (.bcp for the binary format, .gz for gzip)").Required().String()
+	simSize         = simCmd.Flag("size", "population size").Default("100").Int()
+	simLength       = simCmd.Flag("length", "genome length").Default("10000").Int()
+	simMutationRate = simCmd.Flag("mutation_rate", "mutation rate per site per generation").Default("1e-5").Float64()
+	simTransferRate = simCmd.Flag("transfer_rate", "transfer rate per site per generation").Default("0").Float64()
+	simFragLen      = simCmd.Flag("frag_len", "transferred fragment length").Default("1000").Int()
+	simGenerations  = simCmd.Flag("generations", "number of generations (0 for 10 times the size)").Default("0").Int()
+	simNumPop       = simCmd.Flag("num_pop", "number of populations").Default("1").Int()
+	simSeed         = simCmd.Flag("seed", "random seed (0 for current time)").Default("0").Int64()
+)
+
+func init() {
+	simCmd.Validate(validateSimulate)
+}
+
+// validateSimulate rejects impossible options of the simulate command.
+func validateSimulate(*kingpin.CmdClause) error {
+	switch {
+	case *simSize < 2:
+		return fmt.Errorf("--size must be at least 2")
+	case *simLength < 1:
+		return fmt.Errorf("--length must be at least 1")
+	case *simMutationRate < 0 || *simTransferRate < 0:
+		return fmt.Errorf("--mutation_rate and --transfer_rate must not be negative")
+	case *simFragLen < 1:
+		return fmt.Errorf("--frag_len must be at least 1")
+	case *simTransferRate > 0 && *simFragLen > *simLength:
+		return fmt.Errorf("--frag_len (%d) must not exceed --length (%d)", *simFragLen, *simLength)
+	case *simGenerations < 0:
+		return fmt.Errorf("--generations must not be negative")
+	case *simNumPop < 1:
+		return fmt.Errorf("--num_pop must be at least 1")
+	}
+	return nil
+}
+
+// simulate runs the simulate command.
+func simulate() {
+	seed := *simSeed
+	if seed == 0 {
+		seed = time.Now().UTC().UnixNano()
+	}
+
+	s := biascorr.NewSimulator(*simSize, *simLength, seed)
+	s.MutationRate = *simMutationRate
+	s.TransferRate = *simTransferRate
+	s.FragLen = *simFragLen
+	if *simGenerations > 0 {
+		s.Generations = *simGenerations
+	}
+
+	pops := make(chan biascorr.Pop)
+	go func() {
+		defer close(pops)
+		for i := 0; i < *simNumPop; i++ {
+			pops <- s.Simulate()
+		}
+	}()
+	if err := biascorr.WritePops(pops, *simOutput); err != nil {
+		log.Panicf("Error when writing populations: %v", err)
+	}
+}
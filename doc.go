@@ -0,0 +1,14 @@
+// Package biascorr calculates correlation profiles of substitutions
+// in sampled clusters of bacterial genomes.
+//
+// Populations are read with ReadPops, which reports errors on a channel,
+// also as substitutions from haploid VCFs or ms output, see ReadVCF
+// and ReadMS, or simulated with a Simulator,
+// clusters are sampled with BiasChoose or RandChooseClusters,
+// by coalescent ranks that WithRanks can take from UPGMA,
+// neighbour-joining or Newick trees,
+// and correlation kernels such as CalcP2 work on in-memory alignments.
+// MeanVar and MeanCov accumulate the results, and a Calculator
+// runs the whole pipeline over a channel of populations.
+// The command line tool is in cmd/bias_corr.
+package biascorr
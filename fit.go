@@ -0,0 +1,157 @@
+package biascorr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// FitResult stores the parameters fitted to a correlation profile.
+type FitResult struct {
+	Params
+	Ks  float64 // measured P2 at lag 0.
+	RSS float64 // weighted residual sum of squares.
+	N   int     // number of lags fitted.
+}
+
+// FitNeutral fits the mutation and transfer rates of ExpectedP2
+// to the measured P2 of type t, keeping the size, fragment length
+// and generation of par. Each lag is weighted by the inverse of the
+// squared standard error of its mean when known.
+func FitNeutral(results []CorrResult, t string, par Params) (FitResult, error) {
+	points := []CorrResult{}
+	ks := math.NaN()
+	for _, res := range results {
+		if res.T != t || res.N == 0 || math.IsNaN(res.M) {
+			continue
+		}
+		points = append(points, res)
+		if res.L == 0 {
+			ks = res.M
+		}
+	}
+	if len(points) < 2 {
+		return FitResult{}, fmt.Errorf("need at least 2 lags of %s to fit, got %d", t, len(points))
+	}
+	if math.IsNaN(ks) {
+		return FitResult{}, fmt.Errorf("no %s at lag 0", t)
+	}
+	if ks <= 0 || ks >= 0.75 {
+		return FitResult{}, fmt.Errorf("%s at lag 0 (%g) is outside (0, 0.75)", t, ks)
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].L < points[j].L })
+
+	weights := make([]float64, len(points))
+	for i, res := range points {
+		weights[i] = 1
+		neff := res.Neff
+		if neff == 0 {
+			neff = float64(res.N)
+		}
+		if se2 := res.V / neff; se2 > 0 && !math.IsInf(se2, 0) {
+			weights[i] = 1 / se2
+		}
+	}
+
+	rss := func(x []float64) float64 {
+		p := par
+		p.MutationRate = math.Exp(x[0])
+		p.TransferRate = math.Exp(x[1])
+		total := 0.0
+		for i, res := range points {
+			d := res.M - ExpectedP2(p, res.L)
+			total += weights[i] * d * d
+		}
+		return total
+	}
+
+	// start from the mutation rate giving the measured Ks,
+	// and a transfer rate of the same order.
+	u := 3.0 / (8.0 * float64(par.Size)) * ks / (0.75 - ks)
+	best := nelderMead(rss, []float64{math.Log(u), math.Log(u)}, 1, 1000)
+
+	fit := FitResult{Params: par, Ks: ks, N: len(points)}
+	fit.MutationRate = math.Exp(best[0])
+	fit.TransferRate = math.Exp(best[1])
+	fit.RSS = rss(best)
+	return fit, nil
+}
+
+// nelderMead minimizes f by the downhill simplex method,
+// starting from x0 with simplex edges of length step.
+func nelderMead(f func([]float64) float64, x0 []float64, step float64, iterations int) []float64 {
+	n := len(x0)
+	simplex := [][]float64{append([]float64{}, x0...)}
+	for i := 0; i < n; i++ {
+		x := append([]float64{}, x0...)
+		x[i] += step
+		simplex = append(simplex, x)
+	}
+	values := make([]float64, n+1)
+	for i, x := range simplex {
+		values[i] = f(x)
+	}
+
+	// along returns c + t (x - c).
+	along := func(c, x []float64, t float64) []float64 {
+		y := make([]float64, n)
+		for i := range y {
+			y[i] = c[i] + t*(x[i]-c[i])
+		}
+		return y
+	}
+
+	for it := 0; it < iterations; it++ {
+		sort.Sort(simplexSorter{simplex, values})
+		if math.Abs(values[n]-values[0]) <= 1e-12*(math.Abs(values[0])+1e-300) {
+			break
+		}
+
+		centroid := make([]float64, n)
+		for _, x := range simplex[:n] {
+			for i := range centroid {
+				centroid[i] += x[i] / float64(n)
+			}
+		}
+
+		reflected := along(centroid, simplex[n], -1)
+		fr := f(reflected)
+		switch {
+		case fr < values[0]:
+			expanded := along(centroid, simplex[n], -2)
+			if fe := f(expanded); fe < fr {
+				simplex[n], values[n] = expanded, fe
+			} else {
+				simplex[n], values[n] = reflected, fr
+			}
+		case fr < values[n-1]:
+			simplex[n], values[n] = reflected, fr
+		default:
+			contracted := along(centroid, simplex[n], 0.5)
+			if fc := f(contracted); fc < values[n] {
+				simplex[n], values[n] = contracted, fc
+				continue
+			}
+			for i := 1; i <= n; i++ {
+				simplex[i] = along(simplex[0], simplex[i], 0.5)
+				values[i] = f(simplex[i])
+			}
+		}
+	}
+
+	sort.Sort(simplexSorter{simplex, values})
+	return simplex[0]
+}
+
+// simplexSorter sorts the points of a simplex by their values.
+type simplexSorter struct {
+	points [][]float64
+	values []float64
+}
+
+func (s simplexSorter) Len() int           { return len(s.values) }
+func (s simplexSorter) Less(i, j int) bool { return s.values[i] < s.values[j] }
+func (s simplexSorter) Swap(i, j int) {
+	s.points[i], s.points[j] = s.points[j], s.points[i]
+	s.values[i], s.values[j] = s.values[j], s.values[i]
+}
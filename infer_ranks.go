@@ -0,0 +1,304 @@
+package biascorr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// RankMethod decides how coalescent ranks are obtained
+// for populations without Ranks.
+type RankMethod int
+
+const (
+	// RanksGiven uses Pop.Ranks only.
+	RanksGiven RankMethod = iota
+	// RanksUPGMA infers ranks from a UPGMA tree of the genomes.
+	RanksUPGMA
+	// RanksNJ infers ranks from a midpoint-rooted neighbour-joining tree.
+	RanksNJ
+)
+
+// RankMethodNames are the command line names of the rank methods.
+var RankMethodNames = []string{"given", "upgma", "nj"}
+
+// ParseRankMethod returns the method named given, upgma or nj.
+func ParseRankMethod(name string) (RankMethod, error) {
+	for i, n := range RankMethodNames {
+		if n == name {
+			return RankMethod(i), nil
+		}
+	}
+	return RanksGiven, fmt.Errorf("unknown rank method: %s", name)
+}
+
+// InferRanks returns the coalescent ranks of a tree built by method,
+// see BuildTree.
+func InferRanks(p Pop, method RankMethod, cmp *SiteComparer) ([][]float64, error) {
+	tree, err := BuildTree(p, method, cmp)
+	if err != nil {
+		return nil, err
+	}
+	return tree.Ranks(p.GenomeNames())
+}
+
+// BuildTree returns the tree built by method from the fractions
+// of differing sites between genomes, whose tips are named
+// by Pop.GenomeNames.
+func BuildTree(p Pop, method RankMethod, cmp *SiteComparer) (*Tree, error) {
+	var tree *Tree
+	switch method {
+	case RanksUPGMA:
+		tree = UPGMA(DistanceMatrix(p, cmp))
+	case RanksNJ:
+		tree = NeighborJoining(DistanceMatrix(p, cmp))
+	default:
+		return nil, fmt.Errorf("no tree to build by method %d", method)
+	}
+	names := p.GenomeNames()
+	for _, tip := range tree.Tips() {
+		i, _ := strconv.Atoi(tip.Name)
+		tip.Name = names[i]
+	}
+	return tree, nil
+}
+
+// WithRanks returns the population with the ranks of tree, whose tips are
+// matched to genome names, see Pop.GenomeNames, if tree is not nil,
+// or else with ranks inferred by method if the population has none.
+func WithRanks(p Pop, method RankMethod, tree *Tree, cmp *SiteComparer) (Pop, error) {
+	var err error
+	switch {
+	case tree != nil:
+		p.Ranks, err = tree.Ranks(p.GenomeNames())
+	case len(p.Ranks) == 0 && method != RanksGiven:
+		p.Ranks, err = InferRanks(p, method, cmp)
+	}
+	return p, err
+}
+
+// DistanceMatrix returns the fractions of differing sites
+// between all pairs of genomes.
+func DistanceMatrix(p Pop, cmp *SiteComparer) [][]float64 {
+	n := p.NumGenomes()
+	distance := genomeDistance(p, cmp)
+	dist := make([][]float64, n)
+	for i := range dist {
+		dist[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			d := distance(i, j)
+			if math.IsNaN(d) {
+				d = 0 // no compared sites.
+			}
+			dist[i][j], dist[j][i] = d, d
+		}
+	}
+	return dist
+}
+
+// UPGMA returns the UPGMA tree of a distance matrix,
+// whose tips are named by their indices.
+func UPGMA(dist [][]float64) *Tree {
+	type cluster struct {
+		node   *Node
+		size   int
+		height float64
+	}
+	clusters := []cluster{}
+	d := [][]float64{}
+	for i := range dist {
+		clusters = append(clusters, cluster{node: &Node{Name: strconv.Itoa(i)}, size: 1})
+		d = append(d, append([]float64{}, dist[i]...))
+	}
+
+	for len(clusters) > 1 {
+		a, b := 0, 1
+		for i := range clusters {
+			for j := i + 1; j < len(clusters); j++ {
+				if d[i][j] < d[a][b] {
+					a, b = i, j
+				}
+			}
+		}
+
+		height := d[a][b] / 2
+		ca, cb := clusters[a], clusters[b]
+		ca.node.Length = math.Max(height-ca.height, 0)
+		cb.node.Length = math.Max(height-cb.height, 0)
+		merged := cluster{
+			node:   &Node{Children: []*Node{ca.node, cb.node}},
+			size:   ca.size + cb.size,
+			height: math.Max(height, math.Max(ca.height, cb.height)),
+		}
+
+		// the merged cluster replaces a, and the last one replaces b.
+		for k := range clusters {
+			v := (d[a][k]*float64(ca.size) + d[b][k]*float64(cb.size)) / float64(merged.size)
+			d[a][k], d[k][a] = v, v
+		}
+		d[a][a] = 0
+		clusters[a] = merged
+		last := len(clusters) - 1
+		clusters[b] = clusters[last]
+		for k := range d {
+			d[b][k], d[k][b] = d[last][k], d[k][last]
+		}
+		d[b][b] = 0
+		clusters = clusters[:last]
+		d = d[:last]
+		for k := range d {
+			d[k] = d[k][:last]
+		}
+	}
+
+	if len(clusters) == 0 {
+		return &Tree{Root: &Node{}}
+	}
+	return &Tree{Root: clusters[0].node}
+}
+
+// njEdge is an edge of an unrooted neighbour-joining tree.
+type njEdge struct {
+	to     int
+	length float64
+}
+
+// NeighborJoining returns the neighbour-joining tree of a distance matrix,
+// rooted at the midpoint of its longest path, whose tips are named
+// by their indices. Negative branch lengths are set to zero.
+func NeighborJoining(dist [][]float64) *Tree {
+	n := len(dist)
+	if n < 3 {
+		return UPGMA(dist)
+	}
+
+	adj := make([][]njEdge, n, 2*n)
+	connect := func(u, v int, length float64) {
+		length = math.Max(length, 0)
+		adj[u] = append(adj[u], njEdge{v, length})
+		adj[v] = append(adj[v], njEdge{u, length})
+	}
+
+	active := make([]int, n)
+	d := make([][]float64, n)
+	for i := range d {
+		active[i] = i
+		d[i] = append([]float64{}, dist[i]...)
+	}
+
+	for len(active) > 2 {
+		m := len(active)
+		r := make([]float64, m)
+		for i := range d {
+			for k := range d[i] {
+				r[i] += d[i][k]
+			}
+		}
+		a, b := 0, 1
+		q := math.Inf(1)
+		for i := 0; i < m; i++ {
+			for j := i + 1; j < m; j++ {
+				if v := float64(m-2)*d[i][j] - r[i] - r[j]; v < q {
+					a, b, q = i, j, v
+				}
+			}
+		}
+
+		u := len(adj)
+		adj = append(adj, nil)
+		dab := d[a][b]
+		la := dab/2 + (r[a]-r[b])/float64(2*(m-2))
+		connect(u, active[a], la)
+		connect(u, active[b], dab-la)
+
+		// u replaces a, and b is removed.
+		for k := 0; k < m; k++ {
+			v := (d[a][k] + d[b][k] - dab) / 2
+			d[a][k], d[k][a] = v, v
+		}
+		d[a][a] = 0
+		active[a] = u
+		active = append(active[:b], active[b+1:]...)
+		d = append(d[:b], d[b+1:]...)
+		for k := range d {
+			d[k] = append(d[k][:b], d[k][b+1:]...)
+		}
+	}
+	connect(active[0], active[1], d[0][1])
+
+	return midpointRoot(adj, n)
+}
+
+// midpointRoot roots an unrooted tree, whose first n nodes are the tips,
+// at the midpoint of the longest path between two tips.
+func midpointRoot(adj [][]njEdge, n int) *Tree {
+	// distances and parents of all nodes from a node.
+	paths := func(from int) ([]float64, []int) {
+		dist := make([]float64, len(adj))
+		parent := make([]int, len(adj))
+		for i := range parent {
+			parent[i] = -1
+		}
+		stack := []int{from}
+		parent[from] = from
+		for len(stack) > 0 {
+			u := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			for _, e := range adj[u] {
+				if parent[e.to] < 0 {
+					parent[e.to] = u
+					dist[e.to] = dist[u] + e.length
+					stack = append(stack, e.to)
+				}
+			}
+		}
+		return dist, parent
+	}
+	farthest := func(dist []float64) int {
+		far := 0
+		for i := 1; i < n; i++ {
+			if dist[i] > dist[far] {
+				far = i
+			}
+		}
+		return far
+	}
+
+	// in a tree, the tip farthest from any tip ends a longest path.
+	dist0, _ := paths(0)
+	a := farthest(dist0)
+	distA, parent := paths(a)
+	b := farthest(distA)
+
+	// walk from b towards a to the edge holding the midpoint.
+	half := distA[b] / 2
+	v := b
+	for parent[v] != v && distA[parent[v]] >= half {
+		v = parent[v]
+	}
+	u := parent[v]
+	if u == v {
+		u = adj[v][0].to
+	}
+
+	root := &Node{}
+	var build func(node, from int, length float64) *Node
+	build = func(node, from int, length float64) *Node {
+		nd := &Node{Length: length}
+		if node < n {
+			nd.Name = strconv.Itoa(node)
+		}
+		for _, e := range adj[node] {
+			if e.to != from {
+				nd.Children = append(nd.Children, build(e.to, node, e.length))
+			}
+		}
+		return nd
+	}
+	edge := math.Abs(distA[v] - distA[u])
+	toV := math.Min(math.Max(distA[v]-half, 0), edge)
+	root.Children = []*Node{build(v, u, toV), build(u, v, edge-toV)}
+	return &Tree{Root: root}
+}
@@ -0,0 +1,95 @@
+package biascorr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LagBin is an inclusive range of lags averaged together.
+// Its results are reported at lag Lo.
+type LagBin struct {
+	Lo, Hi int
+}
+
+// LinearLags returns every lag from 0 to maxl-1.
+func LinearLags(maxl int) []LagBin {
+	bins := []LagBin{}
+	for l := 0; l < maxl; l++ {
+		bins = append(bins, LagBin{Lo: l, Hi: l})
+	}
+	return bins
+}
+
+// LogLags returns n lags spaced logarithmically between 1 and maxl-1, and lag 0.
+// If binned, each lag is extended to a bin reaching the next lag.
+func LogLags(maxl, n int, binned bool) []LagBin {
+	points := []int{0}
+	if maxl > 1 && n > 0 {
+		ratio := math.Pow(float64(maxl-1), 1/math.Max(float64(n-1), 1))
+		v := 1.0
+		for i := 0; i < n; i++ {
+			l := int(math.Floor(v + 0.5))
+			if l > points[len(points)-1] && l < maxl {
+				points = append(points, l)
+			}
+			v *= ratio
+		}
+	}
+
+	bins := []LagBin{}
+	for i, l := range points {
+		bin := LagBin{Lo: l, Hi: l}
+		if binned && l > 0 {
+			if i+1 < len(points) {
+				bin.Hi = points[i+1] - 1
+			} else {
+				bin.Hi = maxl - 1
+			}
+		}
+		bins = append(bins, bin)
+	}
+	return bins
+}
+
+// ParseLags parses a comma-separated list of lags and lag ranges,
+// such as "1,2,5,10-19". Lag 0 is always included, since Pn is normalized by it.
+func ParseLags(s string) ([]LagBin, error) {
+	bins := []LagBin{{Lo: 0, Hi: 0}}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		bounds := strings.SplitN(term, "-", 2)
+		lo, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad lag %s: %v", term, err)
+		}
+		hi := lo
+		if len(bounds) == 2 {
+			hi, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return nil, fmt.Errorf("bad lag range %s: %v", term, err)
+			}
+		}
+		if lo < 0 || hi < lo {
+			return nil, fmt.Errorf("bad lag range %s", term)
+		}
+		if lo == 0 && hi == 0 {
+			continue
+		}
+		bins = append(bins, LagBin{Lo: lo, Hi: hi})
+	}
+
+	sort.Slice(bins, func(i, j int) bool { return bins[i].Lo < bins[j].Lo })
+	for i := 1; i < len(bins); i++ {
+		if bins[i].Lo <= bins[i-1].Hi {
+			return nil, fmt.Errorf("lag bins %d-%d and %d-%d overlap", bins[i-1].Lo, bins[i-1].Hi, bins[i].Lo, bins[i].Hi)
+		}
+	}
+
+	return bins, nil
+}
@@ -0,0 +1,51 @@
+package biascorr
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLogLags(t *testing.T) {
+	want := []LagBin{{0, 0}, {1, 1}, {3, 3}, {10, 10}, {31, 31}, {99, 99}}
+	if got := LogLags(100, 5, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("log lags %v, want %v", got, want)
+	}
+	want = []LagBin{{0, 0}, {1, 2}, {3, 9}, {10, 30}, {31, 98}, {99, 99}}
+	if got := LogLags(100, 5, true); !reflect.DeepEqual(got, want) {
+		t.Errorf("log bins %v, want %v", got, want)
+	}
+
+	// more lags than there are leave out those rounded to the same lag.
+	if got := LogLags(10, 20, false); !reflect.DeepEqual(got, LinearLags(10)) {
+		t.Errorf("dense log lags %v, want every lag", got)
+	}
+	if got := LogLags(10, 20, true); !reflect.DeepEqual(got, LinearLags(10)) {
+		t.Errorf("dense log bins %v, want every lag", got)
+	}
+
+	for _, tt := range []struct{ maxl, n int }{{1, 5}, {100, 0}} {
+		if got := LogLags(tt.maxl, tt.n, true); !reflect.DeepEqual(got, []LagBin{{0, 0}}) {
+			t.Errorf("maxl %d, %d lags: %v, want lag 0 only", tt.maxl, tt.n, got)
+		}
+	}
+}
+
+func TestParseLags(t *testing.T) {
+	tests := map[string][]LagBin{
+		"1,2,5,10-19":  {{0, 0}, {1, 1}, {2, 2}, {5, 5}, {10, 19}},
+		" 10-19, 2,1 ": {{0, 0}, {1, 1}, {2, 2}, {10, 19}},
+		"0,3":          {{0, 0}, {3, 3}},
+		"":             {{0, 0}},
+	}
+	for s, want := range tests {
+		if got, err := ParseLags(s); err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: lags %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	for _, s := range []string{"a", "3-x", "5-3", "-1", "1.5", "5,5", "1-5,3", "2-4,4-6"} {
+		if got, err := ParseLags(s); err == nil {
+			t.Errorf("%q was parsed as %v", s, got)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package biascorr
+
+import "math"
+
+// CalcLD calculates linkage disequilibrium r^2 and D' between
+// segregating sites in each lag bin, averaged over site pairs.
+// Each site is reduced to the major allele against all others.
+func CalcLD(genomes []string, bins []LagBin, circular bool, cmp *SiteComparer) (results []Result) {
+	missing := MissingRaw
+	if cmp != nil {
+		missing = cmp.Missing
+	}
+	length := len(genomes[0])
+	major := make([]byte, length)
+	segregating := make([]bool, length)
+	for k := 0; k < length; k++ {
+		if cmp.Masked(k) {
+			continue
+		}
+		counts := make(map[byte]int)
+		for _, g := range genomes {
+			if missing == MissingIgnore && IsMissing(g[k]) {
+				continue
+			}
+			counts[g[k]]++
+		}
+		best := 0
+		for b, n := range counts {
+			if n > best || (n == best && b < major[k]) {
+				major[k] = b
+				best = n
+			}
+		}
+		segregating[k] = len(counts) > 1
+	}
+
+	for _, bin := range bins {
+		var r2s, dps float64
+		n := 0
+		for l := bin.Lo; l <= bin.Hi; l++ {
+			if l == 0 {
+				continue
+			}
+			for i := 0; i < length; i++ {
+				j, ok := cmp.Lagged(i, l, length, circular)
+				if !ok || !segregating[i] || !segregating[j] {
+					continue
+				}
+				r2, dp, ok := pairLD(genomes, i, j, major[i], major[j], missing)
+				if ok {
+					r2s += r2
+					dps += dp
+					n++
+				}
+			}
+		}
+		if bin.Hi == 0 {
+			continue
+		}
+		results = append(results, Result{Lag: bin.Lo, N: n, Sites: n, Type: "R2", Value: r2s / float64(n)})
+		results = append(results, Result{Lag: bin.Lo, N: n, Sites: n, Type: "Dp", Value: dps / float64(n)})
+	}
+
+	return
+}
+
+// pairLD returns r^2 and D' between sites i and j,
+// and false if either site is monomorphic in the genomes compared.
+func pairLD(genomes []string, i, j int, a, b byte, missing MissingPolicy) (r2, dp float64, ok bool) {
+	var n, na, nb, nab float64
+	for _, g := range genomes {
+		if missing == MissingIgnore && (IsMissing(g[i]) || IsMissing(g[j])) {
+			continue
+		}
+		x := g[i] == a
+		y := g[j] == b
+		if x {
+			na++
+		}
+		if y {
+			nb++
+		}
+		if x && y {
+			nab++
+		}
+		n++
+	}
+
+	pa, pb, pab := na/n, nb/n, nab/n
+	va := pa * (1 - pa)
+	vb := pb * (1 - pb)
+	if n == 0 || va == 0 || vb == 0 {
+		return 0, 0, false
+	}
+
+	d := pab - pa*pb
+	r2 = d * d / (va * vb)
+	var dmax float64
+	if d > 0 {
+		dmax = math.Min(pa*(1-pb), (1-pa)*pb)
+	} else {
+		dmax = math.Min(pa*pb, (1-pa)*(1-pb))
+	}
+	dp = math.Abs(d) / dmax
+	return r2, dp, true
+}
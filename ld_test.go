@@ -0,0 +1,67 @@
+package biascorr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalcLD(t *testing.T) {
+	tests := []struct {
+		name    string
+		genomes []string
+		missing MissingPolicy
+		r2, dp  float64
+		n       int
+	}{
+		{"perfect", []string{"AC", "AC", "GT", "GT"}, MissingRaw, 1, 1, 1},
+		{"independent", []string{"AC", "AT", "GC", "GT"}, MissingRaw, 0, 0, 1},
+		// pA = 3/4, pC = 1/2, pAC = 1/2, so D = 1/8 = Dmax.
+		{"partial", []string{"AC", "AC", "AT", "GT"}, MissingRaw, 1.0 / 3, 1, 1},
+		{"monomorphic", []string{"AC", "GC", "AC", "GC"}, MissingRaw, math.NaN(), math.NaN(), 0},
+		// N is an allele other than the major A, so pA = 2/5, pC = 3/5, pAC = 2/5.
+		{"missing raw", []string{"AC", "AC", "GT", "GT", "NC"}, MissingRaw, 4.0 / 9, 1, 1},
+		{"missing ignored", []string{"AC", "AC", "GT", "GT", "NC"}, MissingIgnore, 1, 1, 1},
+		{"missing only", []string{"AC", "NT", "AC", "NT"}, MissingIgnore, math.NaN(), math.NaN(), 0},
+	}
+	bins := []LagBin{{Lo: 0, Hi: 0}, {Lo: 1, Hi: 1}}
+	for _, tt := range tests {
+		results := CalcLD(tt.genomes, bins, false, NewSiteComparer(tt.missing, nil))
+		if len(results) != 2 {
+			t.Errorf("%s: %d results, want R2 and Dp of lag 1", tt.name, len(results))
+			continue
+		}
+		r2, dp := results[0], results[1]
+		if r2.Type != "R2" || dp.Type != "Dp" || r2.Lag != 1 || r2.N != tt.n || dp.N != tt.n {
+			t.Errorf("%s: results %+v", tt.name, results)
+		}
+		if !closeOrNaN(r2.Value, tt.r2) || !closeOrNaN(dp.Value, tt.dp) {
+			t.Errorf("%s: r2 %g and D' %g, want %g and %g", tt.name, r2.Value, dp.Value, tt.r2, tt.dp)
+		}
+	}
+}
+
+func TestPairLD(t *testing.T) {
+	genomes := []string{"AC", "AC", "GT", "GT"}
+	if _, _, ok := pairLD(genomes, 0, 0, 'A', 'A', MissingRaw); !ok {
+		t.Error("a segregating site is not in LD with itself")
+	}
+	if _, _, ok := pairLD([]string{"AC", "AT"}, 0, 1, 'A', 'C', MissingRaw); ok {
+		t.Error("LD with a monomorphic site was reported")
+	}
+	if _, _, ok := pairLD([]string{"NC", "-T"}, 0, 1, 'A', 'C', MissingIgnore); ok {
+		t.Error("LD without compared genomes was reported")
+	}
+	// negative D: A goes with T.
+	r2, dp, _ := pairLD([]string{"AT", "AT", "GC", "GC"}, 0, 1, 'A', 'C', MissingRaw)
+	if !closeOrNaN(r2, 1) || !closeOrNaN(dp, 1) {
+		t.Errorf("repulsion: r2 %g and D' %g, want 1 and 1", r2, dp)
+	}
+}
+
+// closeOrNaN returns true if x and y are both NaN or nearly equal.
+func closeOrNaN(x, y float64) bool {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.IsNaN(x) && math.IsNaN(y)
+	}
+	return math.Abs(x-y) < 1e-12
+}
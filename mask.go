@@ -0,0 +1,106 @@
+package biascorr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ReadMask reads a site mask from a BED file (.bed), whose intervals
+// must all lie on the same chromosome, or from a per-site mask file
+// of 0s and 1s, where 1 excludes the site.
+func ReadMask(file string) ([]bool, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mask := []bool{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 1024*1024), 1024*1024*1024)
+	isBed := isBedFile(file)
+	chrom := ""
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if isBed {
+			if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "track") || strings.HasPrefix(line, "browser") {
+				continue
+			}
+			c, start, end, err := parseBedLine(line, lineNum)
+			if err != nil {
+				return nil, fmt.Errorf("mask file %s: %v", file, err)
+			}
+			if chrom == "" {
+				chrom = c
+			} else if c != chrom {
+				return nil, fmt.Errorf("mask file %s line %d: chromosome %s after %s, but a mask applies to one sequence", file, lineNum, c, chrom)
+			}
+			for len(mask) < end {
+				mask = append(mask, false)
+			}
+			for k := start; k < end; k++ {
+				mask[k] = true
+			}
+		} else {
+			for _, b := range line {
+				switch b {
+				case '0':
+					mask = append(mask, false)
+				case '1':
+					mask = append(mask, true)
+				case ' ', '\t':
+				default:
+					return nil, fmt.Errorf("mask file %s line %d: unexpected character %q", file, lineNum, b)
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return mask, nil
+}
+
+// isBedFile returns true if a mask file is a BED file, see ReadMask.
+func isBedFile(file string) bool {
+	return strings.HasSuffix(file, ".bed")
+}
+
+// CheckMask returns a *PopError if the mask read from file does not fit
+// the genomes of the population: a per-site mask must have a value for
+// every site, and the intervals of a BED file must end within the genome.
+func CheckMask(file string, mask []bool, p Pop) error {
+	length := p.GenomeLength()
+	if len(mask) > length || (!isBedFile(file) && len(mask) < length) {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Length",
+			Err: fmt.Errorf("mask file %s covers %d sites, but the genome length is %d", file, len(mask), length)}
+	}
+	return nil
+}
+
+// parseBedLine returns the chromosome and the 0-based, half-open interval
+// of a BED line.
+func parseBedLine(line string, lineNum int) (chrom string, start, end int, err error) {
+	terms := strings.Fields(line)
+	if len(terms) < 3 {
+		return "", 0, 0, fmt.Errorf("line %d: expected at least 3 columns, got %d", lineNum, len(terms))
+	}
+	start, err = strconv.Atoi(terms[1])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("line %d: bad start %s: %v", lineNum, terms[1], err)
+	}
+	end, err = strconv.Atoi(terms[2])
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("line %d: bad end %s: %v", lineNum, terms[2], err)
+	}
+	if start < 0 || end < start {
+		return "", 0, 0, fmt.Errorf("line %d: bad interval [%d, %d)", lineNum, start, end)
+	}
+	return terms[0], start, end, nil
+}
@@ -0,0 +1,68 @@
+package biascorr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadMask(t *testing.T) {
+	dir := t.TempDir()
+	sites := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(sites, []byte("0110\n 0 1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mask, err := ReadMask(sites)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, true, true, false, false, true}; !reflect.DeepEqual(mask, want) {
+		t.Errorf("per-site mask %v, want %v", mask, want)
+	}
+
+	bed := filepath.Join(dir, "a.bed")
+	content := "track name=mask\nchr\t1\t3\nchr\t4\t5\n"
+	if err := os.WriteFile(bed, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	mask, err = ReadMask(bed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []bool{false, true, true, false, true}; !reflect.DeepEqual(mask, want) {
+		t.Errorf("BED mask %v, want %v", mask, want)
+	}
+
+	if err := os.WriteFile(bed, []byte(content+"plasmid\t0\t2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadMask(bed); err == nil || !strings.Contains(err.Error(), "line 4: chromosome plasmid") {
+		t.Errorf("intervals of two chromosomes were merged: %v", err)
+	}
+}
+
+func TestCheckMask(t *testing.T) {
+	p := Pop{Genomes: []string{"ACGTA", "ACGTT"}, Source: "p.json"}
+	tests := []struct {
+		file string
+		mask []bool
+		ok   bool
+	}{
+		{"a.txt", make([]bool, 5), true},
+		{"a.txt", make([]bool, 4), false},
+		{"a.txt", make([]bool, 6), false},
+		{"a.bed", make([]bool, 4), true},
+		{"a.bed", make([]bool, 6), false},
+	}
+	for _, tt := range tests {
+		err := CheckMask(tt.file, tt.mask, p)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s of %d sites: %v", tt.file, len(tt.mask), err)
+		}
+		if pe, isPop := err.(*PopError); err != nil && (!isPop || pe.Field != "Length" || !strings.Contains(err.Error(), tt.file)) {
+			t.Errorf("%s of %d sites: error %v names another field or not the file", tt.file, len(tt.mask), err)
+		}
+	}
+}
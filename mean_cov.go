@@ -1,23 +1,20 @@
-package main
+package biascorr
 
-import (
-	"github.com/mingzhi/gomath/stat/correlation"
-	"github.com/mingzhi/gomath/stat/desc"
-)
+import "math"
 
 // MeanCov implements the law of total covariance.
 type MeanCov struct {
 	xy, xbar, ybar float64
 	n              int
-	Mean           *desc.Mean
-	Cov            *correlation.BivariateCovariance
+	Mean           *Mean
+	Cov            *BivariateCovariance
 }
 
 // NewMeanCov returns a new MeanCov.
 func NewMeanCov() *MeanCov {
 	mc := &MeanCov{}
-	mc.Mean = desc.NewMean()
-	mc.Cov = correlation.NewBivariateCovariance(false)
+	mc.Mean = NewMean()
+	mc.Cov = NewBivariateCovariance(false)
 	return mc
 }
 
@@ -55,3 +52,74 @@ func (m *MeanCov) MeanXbar() float64 {
 func (m *MeanCov) MeanYbar() float64 {
 	return m.ybar / float64(m.n)
 }
+
+// Mean calculates the mean in the increment way.
+type Mean struct {
+	n int
+	m float64
+}
+
+// NewMean returns a new Mean.
+func NewMean() *Mean {
+	return &Mean{}
+}
+
+// Increment adds a value.
+func (m *Mean) Increment(v float64) {
+	m.n++
+	m.m += (v - m.m) / float64(m.n)
+}
+
+// GetResult returns the mean, or NaN if there are no values.
+func (m *Mean) GetResult() float64 {
+	if m.n == 0 {
+		return math.NaN()
+	}
+	return m.m
+}
+
+// GetN returns the number of values.
+func (m *Mean) GetN() int {
+	return m.n
+}
+
+// BivariateCovariance calculates the covariance of two variables
+// in the increment way.
+type BivariateCovariance struct {
+	n                   int
+	meanX, meanY        float64
+	covarianceNumerator float64
+	biasCorrected       bool
+}
+
+// NewBivariateCovariance returns a new BivariateCovariance.
+// If biasCorrected, the covariance is divided by n-1 instead of n.
+func NewBivariateCovariance(biasCorrected bool) *BivariateCovariance {
+	return &BivariateCovariance{biasCorrected: biasCorrected}
+}
+
+// Increment adds a pair of values.
+func (c *BivariateCovariance) Increment(x, y float64) {
+	c.n++
+	dx := x - c.meanX
+	dy := y - c.meanY
+	c.meanX += dx / float64(c.n)
+	c.meanY += dy / float64(c.n)
+	c.covarianceNumerator += float64(c.n-1) / float64(c.n) * dx * dy
+}
+
+// GetResult returns the covariance, or NaN if there are less than two pairs.
+func (c *BivariateCovariance) GetResult() float64 {
+	if c.n < 2 {
+		return math.NaN()
+	}
+	if c.biasCorrected {
+		return c.covarianceNumerator / float64(c.n-1)
+	}
+	return c.covarianceNumerator / float64(c.n)
+}
+
+// GetN returns the number of pairs.
+func (c *BivariateCovariance) GetN() int {
+	return c.n
+}
@@ -0,0 +1,71 @@
+package biascorr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestMean(t *testing.T) {
+	m := NewMean()
+	if !math.IsNaN(m.GetResult()) {
+		t.Errorf("mean of no values = %g, want NaN", m.GetResult())
+	}
+	for _, v := range []float64{1, 2, 3, 4} {
+		m.Increment(v)
+	}
+	if m.GetResult() != 2.5 || m.GetN() != 4 {
+		t.Errorf("got mean %g of %d values, want 2.5 of 4", m.GetResult(), m.GetN())
+	}
+}
+
+func TestBivariateCovariance(t *testing.T) {
+	xs := []float64{1, 2, 3, 4, 5}
+	ys := []float64{2, 1, 4, 3, 7}
+	var mx, my float64
+	for i := range xs {
+		mx += xs[i]
+		my += ys[i]
+	}
+	mx /= float64(len(xs))
+	my /= float64(len(ys))
+	sum := 0.0
+	for i := range xs {
+		sum += (xs[i] - mx) * (ys[i] - my)
+	}
+
+	for _, biasCorrected := range []bool{false, true} {
+		c := NewBivariateCovariance(biasCorrected)
+		for i := range xs {
+			c.Increment(xs[i], ys[i])
+		}
+		want := sum / float64(len(xs))
+		if biasCorrected {
+			want = sum / float64(len(xs)-1)
+		}
+		if !closeTo(c.GetResult(), want) {
+			t.Errorf("biasCorrected %v: covariance = %g, want %g", biasCorrected, c.GetResult(), want)
+		}
+	}
+}
+
+func TestMeanCov(t *testing.T) {
+	mc := NewMeanCov()
+	mc.Add(0.5, 0.6, 0.7, 10)
+	mc.Add(0.2, 0.3, 0.4, 30)
+
+	if !closeTo(mc.MeanXY(), (0.5*10+0.2*30)/40) {
+		t.Errorf("MeanXY() = %g", mc.MeanXY())
+	}
+	wantCt := mc.MeanXY() - mc.MeanXbar()*mc.MeanYbar()
+	if !closeTo(mc.Ct(), wantCt) {
+		t.Errorf("Ct() = %g, want %g", mc.Ct(), wantCt)
+	}
+	wantMean := ((0.5 - 0.6*0.7) + (0.2 - 0.3*0.4)) / 2
+	if !closeTo(mc.Mean.GetResult(), wantMean) {
+		t.Errorf("mean of within covariances = %g, want %g", mc.Mean.GetResult(), wantMean)
+	}
+	// covariance of (0.6, 0.7) and (0.3, 0.4).
+	if !closeTo(mc.Cov.GetResult(), 0.0225) {
+		t.Errorf("covariance of means = %g, want 0.0225", mc.Cov.GetResult())
+	}
+}
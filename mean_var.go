@@ -1,14 +1,22 @@
-package main
+package biascorr
 
 import "math"
 
-// MeanVar is for calculate mean and variance in the increment way.
+// MeanVar is for calculate mean, variance and higher moments in the increment way.
+// Values may be weighted, in which case the moments are weighted
+// and EffectiveN gives the effective sample size.
+// Two MeanVars are merged by Append with the formulas of Chan et al. and Pébay,
+// so the order of adding and merging does not change the results.
 type MeanVar struct {
 	N             int     // number of values.
+	W             float64 // sum of weights.
+	W2            float64 // sum of squared weights.
 	M1            float64 // first moment.
-	Dev           float64
-	NDev          float64
-	M2            float64 // second moment.
+	Dev           float64 // deviation of the last added mean from the previous mean.
+	NDev          float64 // change of the mean in the last update.
+	M2            float64 // second central moment sum.
+	M3            float64 // third central moment sum.
+	M4            float64 // fourth central moment sum.
 	BiasCorrected bool
 }
 
@@ -19,17 +27,15 @@ func NewMeanVar() *MeanVar {
 
 // Add adds a value.
 func (m *MeanVar) Add(v float64) {
-	if m.N < 1 {
-		m.M1 = 0
-		m.M2 = 0
-	}
+	m.AddWeighted(v, 1)
+}
 
-	m.N++
-	n0 := m.N
-	m.Dev = v - m.M1
-	m.NDev = m.Dev / float64(n0)
-	m.M1 += m.NDev
-	m.M2 += float64(m.N-1) * m.Dev * m.NDev
+// AddWeighted adds a value with weight w.
+func (m *MeanVar) AddWeighted(v, w float64) {
+	if w <= 0 {
+		return
+	}
+	m.Append(&MeanVar{N: 1, W: w, W2: w * w, M1: v})
 }
 
 // Mean returns the mean result.
@@ -44,31 +50,76 @@ func (m *MeanVar) Variance() float64 {
 	}
 
 	if m.BiasCorrected {
-		return m.M2 / float64(m.N-1)
+		return m.M2 / (m.W - m.W2/m.W)
+	}
+
+	return m.M2 / m.W
+}
+
+// Skewness returns the skewness.
+func (m *MeanVar) Skewness() float64 {
+	if m.N < 2 || m.M2 == 0 {
+		return math.NaN()
+	}
+	return math.Sqrt(m.W) * m.M3 / math.Pow(m.M2, 1.5)
+}
+
+// Kurtosis returns the excess kurtosis.
+func (m *MeanVar) Kurtosis() float64 {
+	if m.N < 2 || m.M2 == 0 {
+		return math.NaN()
 	}
+	return m.W*m.M4/(m.M2*m.M2) - 3
+}
 
-	return m.M2 / float64(m.N)
+// EffectiveN returns the effective sample size of the weighted values,
+// which equals N for unweighted values.
+func (m *MeanVar) EffectiveN() float64 {
+	if m.W2 == 0 {
+		return 0
+	}
+	return m.W * m.W / m.W2
 }
 
 // Append add another result.
 func (m *MeanVar) Append(m2 *MeanVar) {
+	if m2.N == 0 {
+		return
+	}
 	if m.N == 0 {
 		m.N = m2.N
+		m.W = m2.W
+		m.W2 = m2.W2
 		m.M1 = m2.M1
 		m.Dev = m2.Dev
 		m.NDev = m2.NDev
 		m.M2 = m2.M2
-	} else {
-		if m2.N > 0 {
-			total1 := m.M1 * float64(m.N)
-			total2 := m2.M1 * float64(m2.N)
-			newMean := (total1 + total2) / float64(m.N+m2.N)
-			delta1 := m.Mean() - newMean
-			delta2 := m2.Mean() - newMean
-			sm := (m.M2 + m2.M2) + float64(m.N)*delta1*delta1 + float64(m2.N)*delta2*delta2
-			m.M1 = newMean
-			m.M2 = sm
-			m.N = m.N + m2.N
-		}
+		m.M3 = m2.M3
+		m.M4 = m2.M4
+		return
 	}
+
+	wa, wb := m.W, m2.W
+	w := wa + wb
+	delta := m2.M1 - m.M1
+	delta2 := delta * delta
+
+	m4 := m.M4 + m2.M4 +
+		delta2*delta2*wa*wb*(wa*wa-wa*wb+wb*wb)/(w*w*w) +
+		6*delta2*(wa*wa*m2.M2+wb*wb*m.M2)/(w*w) +
+		4*delta*(wa*m2.M3-wb*m.M3)/w
+	m3 := m.M3 + m2.M3 +
+		delta2*delta*wa*wb*(wa-wb)/(w*w) +
+		3*delta*(wa*m2.M2-wb*m.M2)/w
+	m2s := m.M2 + m2.M2 + delta2*wa*wb/w
+
+	m.Dev = delta
+	m.NDev = delta * wb / w
+	m.M1 += m.NDev
+	m.M2 = m2s
+	m.M3 = m3
+	m.M4 = m4
+	m.N += m2.N
+	m.W = w
+	m.W2 += m2.W2
 }
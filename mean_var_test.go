@@ -0,0 +1,148 @@
+package biascorr
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+	"testing/quick"
+)
+
+// directMoments calculates weighted moments by two passes.
+func directMoments(values, weights []float64) (mean, m2, m3, m4 float64) {
+	w := 0.0
+	for i, v := range values {
+		mean += v * weights[i]
+		w += weights[i]
+	}
+	mean /= w
+	for i, v := range values {
+		d := v - mean
+		m2 += weights[i] * d * d
+		m3 += weights[i] * d * d * d
+		m4 += weights[i] * d * d * d * d
+	}
+	return
+}
+
+func closeTo(a, b float64) bool {
+	return math.Abs(a-b) <= 1e-8*math.Max(1, math.Max(math.Abs(a), math.Abs(b)))
+}
+
+func sameMoments(a, b *MeanVar) bool {
+	return a.N == b.N && closeTo(a.W, b.W) && closeTo(a.M1, b.M1) &&
+		closeTo(a.M2, b.M2) && closeTo(a.M3, b.M3) && closeTo(a.M4, b.M4)
+}
+
+func TestMeanVarMoments(t *testing.T) {
+	values := []float64{1, 2, 4, 7, 11, 3.5}
+	weights := []float64{1, 2, 1, 0.5, 3, 1}
+	mv := NewMeanVar()
+	for i, v := range values {
+		mv.AddWeighted(v, weights[i])
+	}
+
+	mean, m2, m3, m4 := directMoments(values, weights)
+	if !closeTo(mv.Mean(), mean) || !closeTo(mv.M2, m2) || !closeTo(mv.M3, m3) || !closeTo(mv.M4, m4) {
+		t.Errorf("got moments %g %g %g %g, want %g %g %g %g", mv.Mean(), mv.M2, mv.M3, mv.M4, mean, m2, m3, m4)
+	}
+}
+
+func TestMeanVarUnweighted(t *testing.T) {
+	values := []float64{2, 4, 4, 4, 5, 5, 7, 9}
+	mv := NewMeanVar()
+	for _, v := range values {
+		mv.Add(v)
+	}
+
+	if mv.Mean() != 5 {
+		t.Errorf("mean = %g, want 5", mv.Mean())
+	}
+	if !closeTo(mv.Variance(), 4) {
+		t.Errorf("variance = %g, want 4", mv.Variance())
+	}
+	mv.BiasCorrected = true
+	if !closeTo(mv.Variance(), 32.0/7.0) {
+		t.Errorf("unbiased variance = %g, want %g", mv.Variance(), 32.0/7.0)
+	}
+	if mv.EffectiveN() != 8 {
+		t.Errorf("effective n = %g, want 8", mv.EffectiveN())
+	}
+	if !closeTo(mv.Skewness(), 0.65625) {
+		t.Errorf("skewness = %g, want 0.65625", mv.Skewness())
+	}
+	if !closeTo(mv.Kurtosis(), -0.21875) {
+		t.Errorf("kurtosis = %g, want -0.21875", mv.Kurtosis())
+	}
+}
+
+func TestMeanVarMergeOrder(t *testing.T) {
+	f := func(raw []float64, seed int64) bool {
+		values := []float64{}
+		for _, v := range raw {
+			if !math.IsNaN(v) && !math.IsInf(v, 0) {
+				values = append(values, math.Mod(v, 1e3))
+			}
+		}
+		if len(values) == 0 {
+			return true
+		}
+
+		sequential := NewMeanVar()
+		for _, v := range values {
+			sequential.Add(v)
+		}
+
+		// split values into random shards, and merge them in random order.
+		r := rand.New(rand.NewSource(seed))
+		shards := make([]*MeanVar, r.Intn(5)+1)
+		for i := range shards {
+			shards[i] = NewMeanVar()
+		}
+		for _, v := range values {
+			shards[r.Intn(len(shards))].Add(v)
+		}
+		merged := NewMeanVar()
+		for _, i := range r.Perm(len(shards)) {
+			merged.Append(shards[i])
+		}
+
+		return sameMoments(sequential, merged)
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMeanVarMergeAssociative(t *testing.T) {
+	f := func(a, b, c []float64) bool {
+		mvs := []*MeanVar{}
+		for _, values := range [][]float64{a, b, c} {
+			mv := NewMeanVar()
+			for _, v := range values {
+				if !math.IsNaN(v) && !math.IsInf(v, 0) {
+					mv.Add(math.Mod(v, 1e3))
+				}
+			}
+			mvs = append(mvs, mv)
+		}
+
+		left := NewMeanVar()
+		left.Append(mvs[0])
+		left.Append(mvs[1])
+		left.Append(mvs[2])
+
+		right := NewMeanVar()
+		right.Append(mvs[1])
+		right.Append(mvs[2])
+		first := NewMeanVar()
+		first.Append(mvs[0])
+		first.Append(right)
+
+		return sameMoments(left, first)
+	}
+
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
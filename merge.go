@@ -0,0 +1,290 @@
+package biascorr
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// resultColumns are the columns of correlation results;
+// the others hold the values of swept options.
+var resultColumns = map[string]bool{
+	"l": true, "m": true, "v": true, "n": true, "t": true,
+	"neff": true, "skew": true, "kurt": true, "w": true, "w2": true,
+}
+
+// ReadCorrResults reads correlation results written by the corr command,
+// and the names of their extra columns, whose values are kept in Sweep.
+// The columns are found by the header, and neff, skew, kurt, w and w2
+// are optional.
+func ReadCorrResults(file string) ([]CorrResult, []string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", file, err)
+	}
+	cols := make(map[string]int)
+	keys, keyCols := []string{}, []int{}
+	for i, name := range header {
+		cols[name] = i
+		if !resultColumns[name] {
+			keys = append(keys, name)
+			keyCols = append(keyCols, i)
+		}
+	}
+	for _, name := range []string{"l", "m", "v", "n", "t"} {
+		if _, found := cols[name]; !found {
+			return nil, nil, fmt.Errorf("%s: missing column %s", file, name)
+		}
+	}
+
+	results := []CorrResult{}
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", file, err)
+		}
+		float := func(name string, def float64) (float64, error) {
+			i, found := cols[name]
+			if !found {
+				return def, nil
+			}
+			v, err := strconv.ParseFloat(record[i], 64)
+			if err != nil {
+				return 0, fmt.Errorf("%s line %d: bad %s %s", file, line, name, record[i])
+			}
+			return v, nil
+		}
+
+		res := CorrResult{T: record[cols["t"]]}
+		if res.L, err = strconv.Atoi(record[cols["l"]]); err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: bad l %s", file, line, record[cols["l"]])
+		}
+		if res.N, err = strconv.Atoi(record[cols["n"]]); err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: bad n %s", file, line, record[cols["n"]])
+		}
+		if res.M, err = float("m", 0); err != nil {
+			return nil, nil, err
+		}
+		if res.V, err = float("v", 0); err != nil {
+			return nil, nil, err
+		}
+		if res.Neff, err = float("neff", float64(res.N)); err != nil {
+			return nil, nil, err
+		}
+		if res.Skew, err = float("skew", math.NaN()); err != nil {
+			return nil, nil, err
+		}
+		if res.Kurt, err = float("kurt", math.NaN()); err != nil {
+			return nil, nil, err
+		}
+		if res.W, err = float("w", 0); err != nil {
+			return nil, nil, err
+		}
+		if res.W2, err = float("w2", 0); err != nil {
+			return nil, nil, err
+		}
+		for _, i := range keyCols {
+			res.Sweep = append(res.Sweep, record[i])
+		}
+		results = append(results, res)
+	}
+
+	return results, keys, nil
+}
+
+// MeanVar rebuilds the moments of a result of N values, whose weights
+// sum to W, and their squares to W2. Results without W, such as those
+// written before it was, are taken as unweighted, with their weights
+// giving the effective sample size.
+// biasCorrected tells whether V is an unbiased variance.
+func (c CorrResult) MeanVar(biasCorrected bool) *MeanVar {
+	mv := NewMeanVar()
+	if c.N == 0 {
+		return mv
+	}
+	mv.N = c.N
+	mv.W = c.W
+	mv.W2 = c.W2
+	if mv.W <= 0 {
+		mv.W = float64(c.N)
+		mv.W2 = 0
+	}
+	if mv.W2 <= 0 {
+		mv.W2 = mv.W
+		if c.Neff > 0 {
+			mv.W2 = mv.W * mv.W / c.Neff
+		}
+	}
+	mv.M1 = c.M
+	if biasCorrected {
+		mv.M2 = c.V * (mv.W - mv.W2/mv.W)
+	} else {
+		mv.M2 = c.V * mv.W
+	}
+	if !math.IsNaN(c.Skew) && !math.IsNaN(c.Kurt) {
+		mv.M3 = c.Skew * math.Pow(mv.M2, 1.5) / math.Sqrt(mv.W)
+		mv.M4 = (c.Kurt + 3) * mv.M2 * mv.M2 / mv.W
+	}
+	return mv
+}
+
+// MergeCorrResults pools results of the same type, lag and sweep values,
+// such as those of several runs over different populations.
+// The results are ordered by the first appearance of their sweep values,
+// and then by type and lag.
+func MergeCorrResults(results []CorrResult, biasCorrected bool) []CorrResult {
+	points := make(map[string]int)
+	sweeps := [][]string{}
+	resMaps := []map[string]map[int]*MeanVar{}
+	for _, res := range results {
+		key := strings.Join(res.Sweep, "\x00")
+		k, found := points[key]
+		if !found {
+			k = len(sweeps)
+			points[key] = k
+			sweeps = append(sweeps, res.Sweep)
+			resMaps = append(resMaps, make(map[string]map[int]*MeanVar))
+		}
+		resMap := resMaps[k]
+		if resMap[res.T] == nil {
+			resMap[res.T] = make(map[int]*MeanVar)
+		}
+		if resMap[res.T][res.L] == nil {
+			resMap[res.T][res.L] = NewMeanVar()
+		}
+		resMap[res.T][res.L].Append(res.MeanVar(biasCorrected))
+	}
+
+	merged := []CorrResult{}
+	for k, resMap := range resMaps {
+		point := getCorrResults(resMap, nil, biasCorrected)
+		sort.Slice(point, func(i, j int) bool {
+			if point[i].T != point[j].T {
+				return point[i].T < point[j].T
+			}
+			return point[i].L < point[j].L
+		})
+		for i := range point {
+			point[i].Sweep = sweeps[k]
+		}
+		merged = append(merged, point...)
+	}
+	return merged
+}
+
+// digestColumns are the columns of result distributions;
+// the others hold the values of swept options.
+var digestColumns = map[string]bool{"l": true, "t": true, "n": true, "digest": true}
+
+// ReadDigests reads the result distributions written by the corr command
+// as TDigest texts, see TDigest.MarshalText, and the names of their
+// extra columns, whose values are kept in Sweep.
+func ReadDigests(file string) ([]CorrResult, []string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	header, err := r.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", file, err)
+	}
+	cols := make(map[string]int)
+	keys, keyCols := []string{}, []int{}
+	for i, name := range header {
+		cols[name] = i
+		if !digestColumns[name] {
+			keys = append(keys, name)
+			keyCols = append(keyCols, i)
+		}
+	}
+	for name := range digestColumns {
+		if _, found := cols[name]; !found {
+			return nil, nil, fmt.Errorf("%s: missing column %s", file, name)
+		}
+	}
+
+	results := []CorrResult{}
+	for line := 2; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", file, err)
+		}
+		res := CorrResult{T: record[cols["t"]], Dist: &TDigest{}}
+		if res.L, err = strconv.Atoi(record[cols["l"]]); err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: bad l %s", file, line, record[cols["l"]])
+		}
+		if res.N, err = strconv.Atoi(record[cols["n"]]); err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: bad n %s", file, line, record[cols["n"]])
+		}
+		if err := res.Dist.UnmarshalText([]byte(record[cols["digest"]])); err != nil {
+			return nil, nil, fmt.Errorf("%s line %d: %v", file, line, err)
+		}
+		for _, i := range keyCols {
+			res.Sweep = append(res.Sweep, record[i])
+		}
+		results = append(results, res)
+	}
+
+	return results, keys, nil
+}
+
+// MergeDigests pools the distributions of results of the same type,
+// lag and sweep values, ordered as by MergeCorrResults.
+func MergeDigests(results []CorrResult) []CorrResult {
+	index := make(map[string]int)
+	merged := []CorrResult{}
+	for _, res := range results {
+		if res.Dist == nil {
+			continue
+		}
+		key := fmt.Sprintf("%s\x00%d\x00%s", res.T, res.L, strings.Join(res.Sweep, "\x00"))
+		k, found := index[key]
+		if !found {
+			k = len(merged)
+			index[key] = k
+			merged = append(merged, CorrResult{L: res.L, T: res.T, Sweep: res.Sweep, Dist: NewTDigest(res.Dist.Compression)})
+		}
+		merged[k].N += res.N
+		merged[k].Dist.Merge(res.Dist)
+	}
+
+	points := make(map[string]int)
+	for _, res := range merged {
+		key := strings.Join(res.Sweep, "\x00")
+		if _, found := points[key]; !found {
+			points[key] = len(points)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		pi, pj := points[strings.Join(merged[i].Sweep, "\x00")], points[strings.Join(merged[j].Sweep, "\x00")]
+		if pi != pj {
+			return pi < pj
+		}
+		if merged[i].T != merged[j].T {
+			return merged[i].T < merged[j].T
+		}
+		return merged[i].L < merged[j].L
+	})
+	return merged
+}
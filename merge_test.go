@@ -0,0 +1,105 @@
+package biascorr
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeWeightedResults(t *testing.T) {
+	// two shards of weighted values, such as runs of --weight pairs.
+	shards := [][][2]float64{
+		{{0.005, 6}, {0.007, 6}, {0.006, 6}},
+		{{0.02, 45}, {0.021, 45}},
+	}
+	all := NewMeanVar()
+	results := []CorrResult{}
+	for _, shard := range shards {
+		mv := NewMeanVar()
+		for _, x := range shard {
+			mv.AddWeighted(x[0], x[1])
+			all.AddWeighted(x[0], x[1])
+		}
+		results = append(results, getCorrResults(map[string]map[int]*MeanVar{"P2": {1: mv}}, nil, false)...)
+	}
+
+	merged := MergeCorrResults(results, false)
+	if len(merged) != 1 {
+		t.Fatalf("%d merged results, want 1", len(merged))
+	}
+	want := getCorrResults(map[string]map[int]*MeanVar{"P2": {1: all}}, nil, false)[0]
+	if got := merged[0]; !closeTo(got.M, want.M) || !closeTo(got.V, want.V) || !closeTo(got.Neff, want.Neff) || got.N != want.N {
+		t.Errorf("merged %+v, want %+v", got, want)
+	}
+}
+
+func TestReadCorrResults(t *testing.T) {
+	csv := "l,m,v,n,t,neff,skew,kurt,w,w2,clusters,mix\n" +
+		"1,0.5,0.1,3,P2,2,0,-1.5,12,54,4,0\n" +
+		"1,0.3,0.1,3,P2,2,0,-1.5,12,54,4,1\n" +
+		"1,0.7,0.1,3,P2,2,0,-1.5,12,54,4,0\n"
+	file := filepath.Join(t.TempDir(), "corr.csv")
+	if err := os.WriteFile(file, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, keys, err := ReadCorrResults(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || !reflect.DeepEqual(keys, []string{"clusters", "mix"}) {
+		t.Fatalf("%d results of sweep columns %v, want 3 of [clusters mix]", len(results), keys)
+	}
+	if mv := results[0].MeanVar(false); mv.W != 12 || mv.W2 != 54 || mv.N != 3 {
+		t.Errorf("moments %+v, want the sums of weights of the file", mv)
+	}
+
+	// each sweep point is pooled apart.
+	merged := MergeCorrResults(results, false)
+	if len(merged) != 2 {
+		t.Fatalf("%d merged results, want 2", len(merged))
+	}
+	if m := merged[0]; !reflect.DeepEqual(m.Sweep, []string{"4", "0"}) || m.N != 6 || !closeTo(m.M, 0.6) {
+		t.Errorf("first sweep point %+v, want 6 values of mean 0.6", m)
+	}
+	if m := merged[1]; !reflect.DeepEqual(m.Sweep, []string{"4", "1"}) || m.N != 3 || !closeTo(m.M, 0.3) {
+		t.Errorf("second sweep point %+v, want 3 values of mean 0.3", m)
+	}
+}
+
+func TestMergeDigests(t *testing.T) {
+	text := func(values ...float64) string {
+		d := NewTDigest(100)
+		for _, x := range values {
+			d.Add(x, 1)
+		}
+		b, _ := d.MarshalText()
+		return string(b)
+	}
+	csv := "l,t,n,digest,mix\n" +
+		"1,P2,2," + text(1, 2) + ",0\n" +
+		"1,P2,1," + text(7) + ",1\n" +
+		"1,P2,3," + text(3, 4, 5) + ",0\n"
+	file := filepath.Join(t.TempDir(), "digests.csv")
+	if err := os.WriteFile(file, []byte(csv), 0644); err != nil {
+		t.Fatal(err)
+	}
+	results, keys, err := ReadDigests(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || !reflect.DeepEqual(keys, []string{"mix"}) {
+		t.Fatalf("%d digests of sweep columns %v, want 3 of [mix]", len(results), keys)
+	}
+
+	merged := MergeDigests(results)
+	if len(merged) != 2 {
+		t.Fatalf("%d merged digests, want 2", len(merged))
+	}
+	if m := merged[0]; m.N != 5 || m.Dist.Count != 5 || m.Dist.Quantile(0.5) != 3 || !reflect.DeepEqual(m.Sweep, []string{"0"}) {
+		t.Errorf("first sweep point: n %d, count %g, median %g, sweep %v; want 5 values of median 3", m.N, m.Dist.Count, m.Dist.Quantile(0.5), m.Sweep)
+	}
+	if m := merged[1]; m.N != 1 || m.Dist.Quantile(0.5) != 7 {
+		t.Errorf("second sweep point: n %d, median %g; want 1 value of 7", m.N, m.Dist.Quantile(0.5))
+	}
+}
@@ -0,0 +1,52 @@
+package biascorr
+
+import "fmt"
+
+// MissingPolicy decides how gaps and ambiguous nucleotides are compared.
+type MissingPolicy int
+
+const (
+	// MissingRaw compares raw bytes, so a gap differs from a nucleotide
+	// but equals another gap.
+	MissingRaw MissingPolicy = iota
+	// MissingIgnore excludes a site from both the number of differences
+	// and the number of compared sites if either genome is missing it.
+	MissingIgnore
+	// MissingAsDiff counts a site as a difference if either genome is missing it.
+	MissingAsDiff
+)
+
+// missingPolicies maps command line names to policies.
+var missingPolicies = map[string]MissingPolicy{
+	"raw":    MissingRaw,
+	"ignore": MissingIgnore,
+	"diff":   MissingAsDiff,
+}
+
+// ParseMissingPolicy returns the policy named raw, ignore or diff.
+func ParseMissingPolicy(name string) (MissingPolicy, error) {
+	policy, found := missingPolicies[name]
+	if !found {
+		return policy, fmt.Errorf("unknown missing data policy: %s", name)
+	}
+	return policy, nil
+}
+
+// IsMissing returns true if b is a gap or an ambiguous IUPAC code.
+func IsMissing(b byte) bool {
+	switch b {
+	case 'A', 'T', 'G', 'C', 'a', 't', 'g', 'c':
+		return false
+	}
+	return true
+}
+
+// CheckGenomeLengths returns an error if genomes differ in length.
+func CheckGenomeLengths(genomes []string) error {
+	for i := 1; i < len(genomes); i++ {
+		if len(genomes[i]) != len(genomes[0]) {
+			return fmt.Errorf("genome %d has length %d, but genome 0 has length %d", i, len(genomes[i]), len(genomes[0]))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package biascorr
+
+import "testing"
+
+func TestParseMissingPolicy(t *testing.T) {
+	for name, want := range map[string]MissingPolicy{"raw": MissingRaw, "ignore": MissingIgnore, "diff": MissingAsDiff} {
+		if got, err := ParseMissingPolicy(name); err != nil || got != want {
+			t.Errorf("%s: policy %d, %v", name, got, err)
+		}
+	}
+	if _, err := ParseMissingPolicy("skip"); err == nil {
+		t.Error("an unknown policy was parsed")
+	}
+}
+
+func TestCompareMissing(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		policy MissingPolicy
+		want   float64
+	}{
+		// a missing site against a nucleotide.
+		{"ACGTA", "ACNTT", MissingRaw, 2.0 / 5},
+		{"ACGTA", "ACNTT", MissingIgnore, 1.0 / 4},
+		{"ACGTA", "ACNTT", MissingAsDiff, 2.0 / 5},
+		// sites missing in both genomes.
+		{"AN-TA", "AN-TC", MissingRaw, 1.0 / 5},
+		{"AN-TA", "AN-TC", MissingIgnore, 1.0 / 3},
+		{"AN-TA", "AN-TC", MissingAsDiff, 3.0 / 5},
+	}
+	for _, tt := range tests {
+		if got := CompareGenomes(tt.a, tt.b, NewSiteComparer(tt.policy, nil)); !closeOrNaN(got, tt.want) {
+			t.Errorf("%s and %s, policy %d: distance %g, want %g", tt.a, tt.b, tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestCalcP2Missing(t *testing.T) {
+	// the genomes differ at sites 0 and 3 and both miss site 1.
+	genomes := []string{"ANGT", "TNGA"}
+	bins := []LagBin{{Lo: 0, Hi: 0}, {Lo: 1, Hi: 1}}
+	tests := []struct {
+		policy MissingPolicy
+		p2     [2]float64
+		sites  [2]int
+	}{
+		{MissingRaw, [2]float64{2.0 / 4, 0}, [2]int{4, 3}},
+		// site 1 leaves both the differences and the site pairs.
+		{MissingIgnore, [2]float64{2.0 / 3, 0}, [2]int{3, 1}},
+		// site 1 differs, and so does the pair of sites 0 and 1.
+		{MissingAsDiff, [2]float64{3.0 / 4, 1.0 / 3}, [2]int{4, 3}},
+	}
+	for _, tt := range tests {
+		results := CalcP2(genomes, bins, false, NewSiteComparer(tt.policy, nil))
+		for b := range bins {
+			r := results[2*b]
+			if r.Type != "P2" || !closeOrNaN(r.Value, tt.p2[b]) || r.Sites != tt.sites[b] {
+				t.Errorf("policy %d, lag %d: %+v, want P2 %g of %d site pairs", tt.policy, bins[b].Lo, r, tt.p2[b], tt.sites[b])
+			}
+		}
+	}
+}
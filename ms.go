@@ -0,0 +1,221 @@
+package biascorr
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// isMS returns true if the reader starts with ms output: text whose first
+// replicate begins with a line "//", after at most a command line
+// and a line of seeds.
+func isMS(r *bufio.Reader) bool {
+	head, _ := r.Peek(r.Size())
+	for _, b := range head {
+		if (b < ' ' || b > '~') && b != '\t' && b != '\n' && b != '\r' {
+			return false
+		}
+	}
+
+	lines := 0
+	for _, line := range bytes.Split(head, []byte("\n")) {
+		fields := strings.Fields(string(line))
+		switch {
+		case len(fields) == 0:
+			continue
+		case strings.HasPrefix(fields[0], "//"):
+			return true
+		}
+		lines++
+		if lines > 2 {
+			return false
+		}
+		if lines == 2 {
+			for _, f := range fields {
+				if _, err := strconv.ParseUint(f, 10, 64); err != nil {
+					return false
+				}
+			}
+		}
+	}
+	return false
+}
+
+// ReadMS reads the replicates of ms output, as written by ms, mspms,
+// scrm or SLiM's outputMS, each as a sparse population, see Pop.Subs.
+// Positions in [0, 1) are scaled to length sites, and segregating sites
+// falling on the same site are moved to the next free one. The other
+// sites are identical in every genome. Alleles 0 to 3 become A, C, G and T,
+// so that 0 is the reference, and N, ? or - are missing.
+func ReadMS(r io.Reader, length int) ([]Pop, error) {
+	mr := newMSReader(bufio.NewReader(r), length)
+	pops := []Pop{}
+	for {
+		p, err := mr.next()
+		if err == io.EOF {
+			return pops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pops = append(pops, p)
+	}
+}
+
+// msReader reads ms output one replicate at a time.
+type msReader struct {
+	r      *bufio.Reader
+	length int
+	nsam   int // number of samples on the command line, if any.
+	line   int
+	peeked *string // a line read ahead.
+}
+
+func newMSReader(r *bufio.Reader, length int) *msReader {
+	return &msReader{r: r, length: length}
+}
+
+// readLine returns the next line without surrounding white space.
+func (mr *msReader) readLine() (string, error) {
+	if s := mr.peeked; s != nil {
+		mr.peeked = nil
+		return *s, nil
+	}
+	s, err := mr.r.ReadString('\n')
+	if err == io.EOF && s != "" {
+		err = nil
+	}
+	mr.line++
+	return strings.TrimSpace(s), err
+}
+
+// unreadLine puts back a line read ahead.
+func (mr *msReader) unreadLine(s string) {
+	mr.peeked = &s
+}
+
+// next returns the population of the next replicate, or io.EOF.
+func (mr *msReader) next() (Pop, error) {
+	for {
+		s, err := mr.readLine()
+		if err != nil {
+			return Pop{}, err
+		}
+		if strings.HasPrefix(s, "//") {
+			break
+		}
+		// the command line, such as "ms 10 2 -t 5", gives the sample size.
+		if fields := strings.Fields(s); mr.line == 1 && len(fields) > 2 {
+			mr.nsam, _ = strconv.Atoi(fields[1])
+		}
+	}
+	if mr.length <= 0 {
+		return Pop{}, fmt.Errorf("ms: the genome length is unknown; give the reference length")
+	}
+
+	s, err := mr.readLine()
+	if err != nil || !strings.HasPrefix(s, "segsites:") {
+		return Pop{}, fmt.Errorf("ms line %d: expected segsites", mr.line)
+	}
+	segsites, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(s, "segsites:")))
+	if err != nil || segsites < 0 {
+		return Pop{}, fmt.Errorf("ms line %d: bad %q", mr.line, s)
+	}
+	sites, err := mr.positions(segsites)
+	if err != nil {
+		return Pop{}, err
+	}
+
+	haplotypes := []string{}
+	for segsites > 0 {
+		s, err := mr.readLine()
+		if err == io.EOF || (err == nil && (s == "" || strings.HasPrefix(s, "//"))) {
+			mr.unreadLine(s)
+			break
+		}
+		if err != nil {
+			return Pop{}, err
+		}
+		if len(s) != segsites {
+			return Pop{}, fmt.Errorf("ms line %d: haplotype of %d sites for %d segregating sites", mr.line, len(s), segsites)
+		}
+		haplotypes = append(haplotypes, s)
+	}
+	n := len(haplotypes)
+	switch {
+	case segsites == 0:
+		n = mr.nsam
+	case mr.nsam > 0 && n != mr.nsam:
+		return Pop{}, fmt.Errorf("ms line %d: %d haplotypes for %d samples", mr.line, n, mr.nsam)
+	}
+	if n == 0 {
+		return Pop{}, fmt.Errorf("ms line %d: no haplotypes", mr.line)
+	}
+
+	p := Pop{Size: n, Length: mr.length}
+	p.Subs = make([]Subs, n)
+	for _, site := range sites {
+		p.Ref = append(p.Ref, Sub{Pos: site, A: 'A'})
+	}
+	for i, h := range haplotypes {
+		for k := 0; k < len(h); k++ {
+			var a byte
+			switch c := h[k]; {
+			case c >= '0' && c <= '3':
+				a = "ACGT"[c-'0']
+			case c == 'N' || c == '?' || c == '-':
+				a = 'N'
+			default:
+				return Pop{}, fmt.Errorf("ms: haplotype %d has %q at segregating site %d", i, c, k)
+			}
+			if a != 'A' {
+				p.Subs[i] = append(p.Subs[i], Sub{Pos: sites[k], A: a})
+			}
+		}
+	}
+	return p, nil
+}
+
+// positions reads the positions line of segsites segregating sites,
+// and returns their sites within the genome length.
+func (mr *msReader) positions(segsites int) ([]int, error) {
+	if segsites == 0 {
+		// ms omits the positions of replicates without segregating sites.
+		s, err := mr.readLine()
+		if err == nil && !strings.HasPrefix(s, "positions:") {
+			mr.unreadLine(s)
+		}
+		return nil, nil
+	}
+
+	s, err := mr.readLine()
+	if err != nil || !strings.HasPrefix(s, "positions:") {
+		return nil, fmt.Errorf("ms line %d: expected positions", mr.line)
+	}
+	fields := strings.Fields(strings.TrimPrefix(s, "positions:"))
+	if len(fields) != segsites {
+		return nil, fmt.Errorf("ms line %d: %d positions for %d segregating sites", mr.line, len(fields), segsites)
+	}
+	sites := []int{}
+	for _, f := range fields {
+		x, err := strconv.ParseFloat(f, 64)
+		if err != nil || x < 0 || x > 1 {
+			return nil, fmt.Errorf("ms line %d: position %q is not in [0, 1]", mr.line, f)
+		}
+		site := int(x * float64(mr.length))
+		if site == mr.length {
+			site-- // at position 1.
+		}
+		if len(sites) > 0 && site <= sites[len(sites)-1] {
+			site = sites[len(sites)-1] + 1
+		}
+		if site >= mr.length {
+			return nil, fmt.Errorf("ms line %d: %d segregating sites do not fit %d sites", mr.line, segsites, mr.length)
+		}
+		sites = append(sites, site)
+	}
+	return sites, nil
+}
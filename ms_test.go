@@ -0,0 +1,112 @@
+package biascorr
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testMS = `ms 3 3 -t 2.0
+1234 5678 9012
+
+//
+segsites: 3
+positions: 0.1000 0.1004 0.9999
+010
+110
+00?
+
+//
+segsites: 0
+
+//
+segsites: 1
+positions: 0.5
+1
+0
+2
+`
+
+func TestReadMS(t *testing.T) {
+	pops, err := ReadMS(strings.NewReader(testMS), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pops) != 3 {
+		t.Fatalf("%d replicates, want 3", len(pops))
+	}
+
+	// the second site falls on the first and moves to the next one.
+	p := pops[0]
+	wantSubs := []Subs{{{101, 'C'}}, {{100, 'C'}, {101, 'C'}}, {{999, 'N'}}}
+	if !reflect.DeepEqual(p.Subs, wantSubs) {
+		t.Errorf("subs %v, want %v", p.Subs, wantSubs)
+	}
+	if p.Size != 3 || p.Length != 1000 || len(p.Ref) != 3 {
+		t.Errorf("size %d, length %d, ref %v", p.Size, p.Length, p.Ref)
+	}
+	if q := pops[1]; q.Size != 3 || q.NumGenomes() != 3 || !q.IsSparse() {
+		t.Errorf("replicate without segregating sites: %+v", q)
+	}
+	if q := pops[2]; !reflect.DeepEqual(q.Subs, []Subs{{{500, 'C'}}, nil, {{500, 'G'}}}) {
+		t.Errorf("multiallelic subs %v", q.Subs)
+	}
+	for _, q := range pops {
+		if err := ValidatePop(q); err != nil {
+			t.Error(err)
+		}
+	}
+
+	for _, bad := range []string{
+		"//\nsegsites: 2\npositions: 0.1\n01\n",
+		"//\nsegsites: 2\npositions: 0.1 0.2\n012\n",
+		"//\nsegsites: 1\npositions: 0.1\nx\n",
+		"ms 3 1\n//\nsegsites: 1\npositions: 0.1\n1\n0\n",
+	} {
+		if _, err := ReadMS(strings.NewReader(bad), 10); err == nil {
+			t.Errorf("bad ms output %q was read", bad)
+		}
+	}
+	if _, err := ReadMS(strings.NewReader("//\nsegsites: 3\npositions: 0.1 0.2 0.3\n011\n"), 2); err == nil {
+		t.Error("more segregating sites than sites were read")
+	}
+
+	file := filepath.Join(t.TempDir(), "ms.out")
+	if err := os.WriteFile(file, []byte(testMS), 0644); err != nil {
+		t.Fatal(err)
+	}
+	read := []Pop{}
+	qs, errc := ReadSelectedPops([]string{file}, Selection{RefLength: 1000, Skip: 1})
+	for q := range qs {
+		read = append(read, q)
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+	if len(read) != 2 || read[1].Index != 2 || !reflect.DeepEqual(read[1].Subs, pops[2].Subs) {
+		t.Errorf("read %+v", read)
+	}
+}
+
+func TestIsMS(t *testing.T) {
+	tests := []struct {
+		head string
+		want bool
+	}{
+		{testMS, true},
+		{"//\nsegsites: 0\n", true},
+		{"slim 10\n\n//\n", true},
+		{"ms 3 1\nnot seeds\n//\n", false},
+		{"a\nb\nc\n//\n", false},
+		{"BCPF\x01\x00\x00\x00R\n//", false},
+		{"{\"Size\": 2}\n", false},
+	}
+	for _, test := range tests {
+		if got := isMS(bufio.NewReader(strings.NewReader(test.head))); got != test.want {
+			t.Errorf("isMS(%q) = %v, want %v", test.head, got, test.want)
+		}
+	}
+}
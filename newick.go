@@ -0,0 +1,167 @@
+package biascorr
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ReadNewick reads a tree from a Newick file, which may be compressed.
+func ReadNewick(file string) (*Tree, error) {
+	f, err := OpenInput(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return ParseNewick(string(b))
+}
+
+// ParseNewick parses a tree in Newick format, such as "((a:1,b:1):2,c:3);".
+// Labels may be quoted and comments in brackets are ignored. If no branch
+// has a length, every branch has length 1, so that depths follow the topology.
+func ParseNewick(s string) (*Tree, error) {
+	np := newickParser{s: s}
+	root, err := np.node()
+	if err == nil {
+		np.skip()
+		if !np.accept(';') {
+			err = fmt.Errorf("expected ; at offset %d", np.pos)
+		}
+	}
+	if err == nil {
+		np.skip()
+		if np.pos < len(np.s) {
+			err = fmt.Errorf("unexpected text after ; at offset %d", np.pos)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("newick: %v", err)
+	}
+
+	if !np.lengths {
+		var setLengths func(n *Node)
+		setLengths = func(n *Node) {
+			for _, c := range n.Children {
+				c.Length = 1
+				setLengths(c)
+			}
+		}
+		setLengths(root)
+	}
+	return &Tree{Root: root}, nil
+}
+
+// newickParser parses Newick text by recursive descent.
+type newickParser struct {
+	s       string
+	pos     int
+	lengths bool // whether any branch length was given.
+}
+
+// skip skips white space and comments.
+func (np *newickParser) skip() {
+	for np.pos < len(np.s) {
+		switch c := np.s[np.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			np.pos++
+		case c == '[':
+			end := strings.IndexByte(np.s[np.pos:], ']')
+			if end < 0 {
+				np.pos = len(np.s)
+			} else {
+				np.pos += end + 1
+			}
+		default:
+			return
+		}
+	}
+}
+
+// accept consumes c if it is next.
+func (np *newickParser) accept(c byte) bool {
+	np.skip()
+	if np.pos < len(np.s) && np.s[np.pos] == c {
+		np.pos++
+		return true
+	}
+	return false
+}
+
+// node parses: ['(' node (',' node)* ')'] [label] [':' length]
+func (np *newickParser) node() (*Node, error) {
+	n := &Node{}
+	if np.accept('(') {
+		for {
+			c, err := np.node()
+			if err != nil {
+				return nil, err
+			}
+			n.Children = append(n.Children, c)
+			if np.accept(')') {
+				break
+			}
+			if !np.accept(',') {
+				return nil, fmt.Errorf("expected , or ) at offset %d", np.pos)
+			}
+		}
+	}
+
+	name, err := np.label()
+	if err != nil {
+		return nil, err
+	}
+	n.Name = name
+	if n.IsTip() && n.Name == "" {
+		return nil, fmt.Errorf("unnamed tip at offset %d", np.pos)
+	}
+
+	if np.accept(':') {
+		np.skip()
+		start := np.pos
+		for np.pos < len(np.s) && strings.IndexByte("0123456789.eE+-", np.s[np.pos]) >= 0 {
+			np.pos++
+		}
+		v, err := strconv.ParseFloat(np.s[start:np.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad branch length %q at offset %d", np.s[start:np.pos], start)
+		}
+		n.Length = v
+		np.lengths = true
+	}
+	return n, nil
+}
+
+// label parses a quoted or unquoted label. Underscores are kept,
+// as they usually are in genome names.
+func (np *newickParser) label() (string, error) {
+	np.skip()
+	if np.pos < len(np.s) && np.s[np.pos] == '\'' {
+		var b strings.Builder
+		for np.pos++; np.pos < len(np.s); np.pos++ {
+			if np.s[np.pos] == '\'' {
+				// a doubled quote stands for a quote.
+				if np.pos+1 < len(np.s) && np.s[np.pos+1] == '\'' {
+					b.WriteByte('\'')
+					np.pos++
+					continue
+				}
+				np.pos++
+				return b.String(), nil
+			}
+			b.WriteByte(np.s[np.pos])
+		}
+		return "", fmt.Errorf("unterminated quoted label")
+	}
+
+	start := np.pos
+	for np.pos < len(np.s) && strings.IndexByte("()[]':;, \t\n\r", np.s[np.pos]) < 0 {
+		np.pos++
+	}
+	return np.s[start:np.pos], nil
+}
@@ -0,0 +1,82 @@
+package biascorr
+
+import (
+	"fmt"
+	"math"
+)
+
+// NormNames lists the supported normalizations of P2.
+var NormNames = []string{"ks", "ks2", "plateau", "cov"}
+
+// NormTypes maps normalizations to their result types.
+var NormTypes = map[string]string{
+	"ks":      "Pn",        // P2 / Ks
+	"ks2":     "PnKs2",     // P2 / Ks^2
+	"plateau": "PnPlateau", // P2 / P2 at large lags
+	"cov":     "PnCov",     // (P2 - Ks^2) / Ks
+}
+
+// NormalizeP2 normalizes the mean P2 of each lag bin,
+// where Ks is P2 at lag 0 and the plateau is the mean P2
+// of the last plateauBins bins besides lag 0 that have values.
+// It returns an error if the normalization is undefined,
+// and the number of bins skipped for lack of P2.
+func NormalizeP2(p2mvs map[int]*MeanVar, bins []LagBin, norm string, plateauBins int) (results []Result, skipped int, err error) {
+	mean := func(l int) (float64, bool) {
+		mv := p2mvs[l]
+		if mv == nil || mv.N == 0 || math.IsNaN(mv.Mean()) {
+			return 0, false
+		}
+		return mv.Mean(), true
+	}
+
+	ks, ok := mean(0)
+	if !ok {
+		return nil, 0, fmt.Errorf("no P2 at lag 0")
+	}
+
+	var denom, offset float64
+	switch norm {
+	case "ks":
+		denom = ks
+	case "ks2":
+		denom = ks * ks
+	case "cov":
+		denom = ks
+		offset = ks * ks
+	case "plateau":
+		total, n := 0.0, 0
+		for i := len(bins) - 1; i >= 0 && n < plateauBins; i-- {
+			if v, ok := mean(bins[i].Lo); ok && bins[i].Lo > 0 {
+				total += v
+				n++
+			}
+		}
+		if n == 0 {
+			return nil, 0, fmt.Errorf("no P2 for the plateau")
+		}
+		denom = total / float64(n)
+	default:
+		return nil, 0, fmt.Errorf("unknown normalization %s", norm)
+	}
+
+	if denom == 0 {
+		return nil, 0, fmt.Errorf("denominator of %s is zero (Ks = %g)", norm, ks)
+	}
+
+	for _, bin := range bins {
+		v, ok := mean(bin.Lo)
+		if !ok {
+			skipped++
+			continue
+		}
+		res := Result{}
+		res.Lag = bin.Lo
+		res.Type = NormTypes[norm]
+		res.N = p2mvs[bin.Lo].N
+		res.Value = (v - offset) / denom
+		results = append(results, res)
+	}
+
+	return
+}
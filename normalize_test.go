@@ -0,0 +1,69 @@
+package biascorr
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+var nan = math.NaN()
+
+// p2MeanVars returns mean-variances of P2 at lags 0, 1 and 2,
+// where NaN values leave a lag without P2.
+func p2MeanVars(values ...float64) map[int]*MeanVar {
+	p2mvs := make(map[int]*MeanVar)
+	for l, v := range values {
+		p2mvs[l] = NewMeanVar()
+		if !math.IsNaN(v) {
+			p2mvs[l].Add(v)
+		}
+	}
+	return p2mvs
+}
+
+func TestNormalizeP2(t *testing.T) {
+	bins := LinearLags(3)
+	results, skipped, err := NormalizeP2(p2MeanVars(0.5, 0.25, 0.2), bins, "ks", 1)
+	if err != nil || skipped != 0 || len(results) != 3 {
+		t.Fatalf("results %v, %d skipped: %v", results, skipped, err)
+	}
+	for i, want := range []float64{1, 0.5, 0.4} {
+		if r := results[i]; r.Lag != i || r.Type != "Pn" || r.N != 1 || !closeOrNaN(r.Value, want) {
+			t.Errorf("result %+v, want Pn %g at lag %d", r, want, i)
+		}
+	}
+
+	// cov subtracts Ks^2, and plateau divides by the last bins with P2.
+	if results, _, _ := NormalizeP2(p2MeanVars(0.5, 0.25, 0.2), bins, "cov", 1); !closeOrNaN(results[1].Value, 0) {
+		t.Errorf("PnCov %g at lag 1, want 0", results[1].Value)
+	}
+	results, skipped, err = NormalizeP2(p2MeanVars(0.5, 0.2, nan), bins, "plateau", 1)
+	if err != nil || skipped != 1 || len(results) != 2 || !closeOrNaN(results[0].Value, 2.5) {
+		t.Errorf("plateau results %v, %d skipped: %v", results, skipped, err)
+	}
+}
+
+func TestNormalizeP2Undefined(t *testing.T) {
+	bins := LinearLags(3)
+	tests := []struct {
+		name   string
+		p2mvs  map[int]*MeanVar
+		norm   string
+		reason string
+	}{
+		{"Ks of zero", p2MeanVars(0, 0.1, 0.1), "ks", "zero"},
+		{"Ks^2 of zero", p2MeanVars(0, 0.1, 0.1), "ks2", "zero"},
+		{"cov of zero Ks", p2MeanVars(0, 0.1, 0.1), "cov", "zero"},
+		{"zero plateau", p2MeanVars(0.5, 0, 0), "plateau", "zero"},
+		{"empty lag 0", p2MeanVars(nan, 0.1, 0.1), "ks", "lag 0"},
+		{"missing lag 0", map[int]*MeanVar{1: p2MeanVars(0.1)[0]}, "ks", "lag 0"},
+		{"empty plateau", p2MeanVars(0.5, nan, nan), "plateau", "plateau"},
+		{"unknown", p2MeanVars(0.5, 0.1, 0.1), "ks3", "unknown"},
+	}
+	for _, tt := range tests {
+		results, _, err := NormalizeP2(tt.p2mvs, bins, tt.norm, 2)
+		if err == nil || !strings.Contains(err.Error(), tt.reason) {
+			t.Errorf("%s: results %v, error %v, want an error on %s", tt.name, results, err, tt.reason)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package biascorr
+
+// NuclCov calculates the covariance of nucleotide differences
+// at two sites over all pairs of sequences.
+type NuclCov struct {
+	Doublets []int // counts of nucleotide doublets at the two sites.
+	Alphabet []byte
+}
+
+// NewNuclCov returns a new NuclCov for the alphabet.
+func NewNuclCov(alphabet []byte) *NuclCov {
+	nc := NuclCov{}
+	nc.Alphabet = alphabet
+	nc.Doublets = make([]int, len(alphabet)*len(alphabet))
+	return &nc
+}
+
+// Add adds the nucleotides a and b of a sequence at the two sites.
+// It returns false if either is not in the alphabet.
+func (nc *NuclCov) Add(a, b byte) bool {
+	i := nc.index(a)
+	j := nc.index(b)
+	if i < 0 || j < 0 {
+		return false
+	}
+	nc.Doublets[i*len(nc.Alphabet)+j]++
+	return true
+}
+
+// Cov returns the mean of xy, x and y over all pairs of sequences,
+// where x and y are 1 if the pair differs at the first and the second site,
+// and the number of pairs.
+func (nc *NuclCov) Cov() (xy, xbar, ybar float64, n int) {
+	size := len(nc.Alphabet)
+	for i := 0; i < len(nc.Doublets); i++ {
+		c1 := nc.Doublets[i]
+		if c1 == 0 {
+			continue
+		}
+		n += c1 * (c1 - 1) / 2
+		for j := i + 1; j < len(nc.Doublets); j++ {
+			c2 := nc.Doublets[j]
+			if c2 == 0 {
+				continue
+			}
+			pairs := float64(c1 * c2)
+			x := i/size != j/size
+			y := i%size != j%size
+			if x {
+				xbar += pairs
+			}
+			if y {
+				ybar += pairs
+			}
+			if x && y {
+				xy += pairs
+			}
+			n += c1 * c2
+		}
+	}
+
+	xy /= float64(n)
+	xbar /= float64(n)
+	ybar /= float64(n)
+	return
+}
+
+// index returns the index of b in the alphabet, or -1.
+func (nc *NuclCov) index(b byte) int {
+	for i, a := range nc.Alphabet {
+		if a == b {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,53 @@
+package biascorr
+
+import "testing"
+
+func TestNuclCov(t *testing.T) {
+	// nucleotides of four sequences at two sites.
+	xs := []byte{'A', 'A', 'T', 'G'}
+	ys := []byte{'C', 'G', 'C', 'C'}
+	nc := NewNuclCov([]byte{'A', 'T', 'G', 'C'})
+	for i := range xs {
+		if !nc.Add(xs[i], ys[i]) {
+			t.Fatalf("Add(%c, %c) returned false", xs[i], ys[i])
+		}
+	}
+
+	// brute force over all pairs of sequences.
+	var wantXY, wantX, wantY float64
+	wantN := 0
+	for i := 0; i < len(xs); i++ {
+		for j := i + 1; j < len(xs); j++ {
+			x := xs[i] != xs[j]
+			y := ys[i] != ys[j]
+			if x {
+				wantX++
+			}
+			if y {
+				wantY++
+			}
+			if x && y {
+				wantXY++
+			}
+			wantN++
+		}
+	}
+	wantXY /= float64(wantN)
+	wantX /= float64(wantN)
+	wantY /= float64(wantN)
+
+	xy, xbar, ybar, n := nc.Cov()
+	if n != wantN || !closeTo(xy, wantXY) || !closeTo(xbar, wantX) || !closeTo(ybar, wantY) {
+		t.Errorf("Cov() = %g, %g, %g, %d, want %g, %g, %g, %d", xy, xbar, ybar, n, wantXY, wantX, wantY, wantN)
+	}
+}
+
+func TestNuclCovOutOfAlphabet(t *testing.T) {
+	nc := NewNuclCov([]byte{'A', 'T', 'G', 'C'})
+	if nc.Add('N', 'A') {
+		t.Error("Add('N', 'A') returned true")
+	}
+	if nc.Add('A', '-') {
+		t.Error("Add('A', '-') returned true")
+	}
+}
@@ -0,0 +1,128 @@
+package biascorr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Stdin is the input name of the standard input.
+const Stdin = "-"
+
+// compressions maps the magic bytes of compressed streams to their names.
+// bgzip files are gzip files of several members.
+var compressions = []struct {
+	magic []byte
+	name  string
+}{
+	{[]byte{0x1f, 0x8b}, "gzip"},
+	{[]byte{0x28, 0xb5, 0x2f, 0xfd}, "zstd"},
+	{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, "xz"},
+	{[]byte("BZh"), "bzip2"},
+}
+
+// input is an opened input with everything to close.
+type input struct {
+	io.Reader
+	closers []io.Closer
+}
+
+// Close closes the decompressor and the file.
+func (in *input) Close() error {
+	var err error
+	for i := len(in.closers) - 1; i >= 0; i-- {
+		if e := in.closers[i].Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// OpenInput opens a file, or the standard input if name is Stdin,
+// decompressing it if its magic bytes show gzip, bgzip, zstd, xz or bzip2.
+func OpenInput(name string) (io.ReadCloser, error) {
+	in := &input{}
+	var f *os.File
+	if name == Stdin {
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		in.closers = append(in.closers, f)
+	}
+
+	br := bufio.NewReader(f)
+	in.Reader = br
+	head, _ := br.Peek(6)
+	var err error
+	switch compression(head) {
+	case "gzip":
+		var gz *gzip.Reader
+		gz, err = gzip.NewReader(br)
+		if err == nil {
+			in.Reader = gz
+			in.closers = append(in.closers, gz)
+		}
+	case "zstd":
+		var zr *zstd.Decoder
+		zr, err = zstd.NewReader(br)
+		if err == nil {
+			in.Reader = zr
+			in.closers = append(in.closers, zr.IOReadCloser())
+		}
+	case "xz":
+		in.Reader, err = xz.NewReader(br)
+	case "bzip2":
+		in.Reader = bzip2.NewReader(br)
+	}
+	if err != nil {
+		in.Close()
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+
+	return in, nil
+}
+
+// compression returns the compression of a stream starting with head,
+// or an empty string.
+func compression(head []byte) string {
+	for _, c := range compressions {
+		if bytes.HasPrefix(head, c.magic) {
+			return c.name
+		}
+	}
+	return ""
+}
+
+// ExpandInputs expands glob patterns into the matching files in order.
+// Names without glob characters, and Stdin, are kept as they are.
+func ExpandInputs(patterns []string) ([]string, error) {
+	files := []string{}
+	for _, pattern := range patterns {
+		if pattern == Stdin || !strings.ContainsAny(pattern, "*?[") {
+			files = append(files, pattern)
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %s: %v", pattern, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
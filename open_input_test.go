@@ -0,0 +1,93 @@
+package biascorr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+func TestOpenInputCompressions(t *testing.T) {
+	content := []byte(`{"Size":2,"Length":2,"Genomes":["AC","AG"]}` + "\n")
+	compressors := map[string]func(io.Writer) io.WriteCloser{
+		"plain": func(w io.Writer) io.WriteCloser { return nopWriteCloser{w} },
+		"gzip":  func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+		"zstd": func(w io.Writer) io.WriteCloser {
+			zw, _ := zstd.NewWriter(w)
+			return zw
+		},
+		"xz": func(w io.Writer) io.WriteCloser {
+			xw, _ := xz.NewWriter(w)
+			return xw
+		},
+	}
+
+	dir := t.TempDir()
+	for name, compress := range compressors {
+		var buf bytes.Buffer
+		w := compress(&buf)
+		w.Write(content)
+		w.Close()
+		// no telling extensions, so only the magic bytes are used.
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := OpenInput(file)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: read %q, %v", name, got, err)
+		}
+
+		pops := []Pop{}
+		read, errc := ReadPops(file, 10)
+		for p := range read {
+			pops = append(pops, p)
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		if len(pops) != 1 || pops[0].Source != file {
+			t.Errorf("%s: read %+v", name, pops)
+		}
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestExpandInputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.json", "a.json", "c.txt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+
+	files, err := ExpandInputs([]string{Stdin, filepath.Join(dir, "*.json"), "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{Stdin, filepath.Join(dir, "a.json"), filepath.Join(dir, "b.json"), "x"}
+	if len(files) != len(want) {
+		t.Fatalf("got %v, want %v", files, want)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("got %v, want %v", files, want)
+		}
+	}
+
+	if _, err := ExpandInputs([]string{filepath.Join(dir, "*.bcp")}); err == nil {
+		t.Error("a pattern without matches was accepted")
+	}
+}
@@ -0,0 +1,166 @@
+package biascorr
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Block is a range of sites [Start, End), such as a contig or a locus.
+// Lagged pairs of a circular block wrap around its ends.
+type Block struct {
+	Name       string
+	Start, End int
+	Circular   bool
+}
+
+// Partition divides the sites of an alignment into blocks,
+// so that lagged site pairs stay within a block.
+// Sites outside every block form no pairs.
+type Partition struct {
+	Blocks []Block
+	site   []int // block of each site, or -1.
+}
+
+// NewPartition returns the partition of sorted, disjoint blocks.
+func NewPartition(blocks []Block) (*Partition, error) {
+	pt := &Partition{Blocks: blocks}
+	for i, b := range blocks {
+		if b.Start < 0 || b.End <= b.Start {
+			return nil, fmt.Errorf("block %s has bad sites [%d, %d)", b.Name, b.Start, b.End)
+		}
+		if i > 0 && b.Start < blocks[i-1].End {
+			return nil, fmt.Errorf("block %s overlaps or precedes block %s", b.Name, blocks[i-1].Name)
+		}
+		for len(pt.site) < b.Start {
+			pt.site = append(pt.site, -1)
+		}
+		for k := b.Start; k < b.End; k++ {
+			pt.site = append(pt.site, i)
+		}
+	}
+	return pt, nil
+}
+
+// PartitionLengths returns the partition of consecutive blocks
+// of the given lengths, such as the contigs of a draft assembly.
+func PartitionLengths(lengths []int, circular bool) (*Partition, error) {
+	blocks := []Block{}
+	start := 0
+	for i, l := range lengths {
+		blocks = append(blocks, Block{Name: strconv.Itoa(i + 1), Start: start, End: start + l, Circular: circular})
+		start += l
+	}
+	return NewPartition(blocks)
+}
+
+// ReadPartition reads a partition file of RAxML-style lines, such as
+// "DNA, adk = 1-536", whose sites are 1-based and inclusive. A block is
+// circular if its line ends with "circular". Blocks may be given in any
+// order, and lines starting with # are comments.
+func ReadPartition(file string) (*Partition, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	blocks := []Block{}
+	scanner := bufio.NewScanner(f)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		b, err := parsePartitionLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("partition file %s line %d: %v", file, lineNum, err)
+		}
+		blocks = append(blocks, b)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Start < blocks[j].Start })
+	pt, err := NewPartition(blocks)
+	if err != nil {
+		return nil, fmt.Errorf("partition file %s: %v", file, err)
+	}
+	return pt, nil
+}
+
+// parsePartitionLine parses "[type,] name = start-end [circular]".
+func parsePartitionLine(line string) (Block, error) {
+	b := Block{}
+	name, sites, ok := strings.Cut(line, "=")
+	if !ok {
+		return b, fmt.Errorf("expected name = start-end")
+	}
+	if _, n, ok := strings.Cut(name, ","); ok {
+		name = n
+	}
+	b.Name = strings.TrimSpace(name)
+
+	terms := strings.Fields(sites)
+	switch {
+	case len(terms) == 2 && terms[1] == "circular":
+		b.Circular = true
+	case len(terms) != 1:
+		return b, fmt.Errorf("expected start-end [circular], got %q", strings.TrimSpace(sites))
+	}
+	lo, hi, ok := strings.Cut(terms[0], "-")
+	start, err1 := strconv.Atoi(lo)
+	end, err2 := strconv.Atoi(hi)
+	if !ok || err1 != nil || err2 != nil || start < 1 || end < start {
+		return b, fmt.Errorf("bad sites %q", terms[0])
+	}
+	b.Start, b.End = start-1, end
+	return b, nil
+}
+
+// Length returns the end of the last block.
+func (pt *Partition) Length() int {
+	return len(pt.site)
+}
+
+// Lagged returns the site at lag l from site i within its block,
+// and false if the site is outside every block, or the lag passes
+// the end of a linear block.
+func (pt *Partition) Lagged(i, l int) (int, bool) {
+	if i >= len(pt.site) || pt.site[i] < 0 {
+		return 0, false
+	}
+	b := pt.Blocks[pt.site[i]]
+	j := i + l
+	if j >= b.End {
+		if !b.Circular {
+			return 0, false
+		}
+		j = b.Start + (j-b.Start)%(b.End-b.Start)
+	}
+	return j, true
+}
+
+// LaggedFrom returns the site from which site j is at lag l within its block,
+// see Lagged, and false if there is none.
+func (pt *Partition) LaggedFrom(j, l int) (int, bool) {
+	if j >= len(pt.site) || pt.site[j] < 0 {
+		return 0, false
+	}
+	b := pt.Blocks[pt.site[j]]
+	i := j - l
+	if i < b.Start {
+		if !b.Circular {
+			return 0, false
+		}
+		n := b.End - b.Start
+		i = b.Start + ((i-b.Start)%n+n)%n
+	}
+	return i, true
+}
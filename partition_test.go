@@ -0,0 +1,81 @@
+package biascorr
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPartition(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "loci.txt")
+	text := "# MLST loci\nDNA, gyrB = 7-10 circular\nDNA, adk = 1-4\n"
+	if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pt, err := ReadPartition(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pt.Blocks) != 2 || pt.Blocks[0] != (Block{Name: "adk", Start: 0, End: 4}) || pt.Length() != 10 {
+		t.Errorf("blocks %+v, length %d", pt.Blocks, pt.Length())
+	}
+
+	tests := []struct {
+		i, l, j int
+		ok      bool
+	}{
+		{0, 3, 3, true},
+		{1, 3, 0, false}, // beyond the linear adk.
+		{4, 1, 0, false}, // between loci.
+		{8, 3, 7, true},  // around the circular gyrB.
+		{9, 0, 9, true},
+	}
+	for _, test := range tests {
+		if j, ok := pt.Lagged(test.i, test.l); ok != test.ok || (ok && j != test.j) {
+			t.Errorf("Lagged(%d, %d) = %d, %v, want %d, %v", test.i, test.l, j, ok, test.j, test.ok)
+		}
+	}
+
+	for _, bad := range [][]Block{{{Name: "a", Start: 2, End: 2}}, {{Name: "a", Start: 0, End: 5}, {Name: "b", Start: 4, End: 8}}} {
+		if _, err := NewPartition(bad); err == nil {
+			t.Errorf("bad blocks %+v were accepted", bad)
+		}
+	}
+	for _, line := range []string{"adk 1-4", "adk = 4-1", "adk = 1-4 linear", "adk = 0-4"} {
+		if _, err := parsePartitionLine(line); err == nil {
+			t.Errorf("bad line %q was parsed", line)
+		}
+	}
+}
+
+func TestPartitionP2(t *testing.T) {
+	genomes := []string{"ACGTACGTAAGT", "ACCTACGAAAGT", "TCGTACGTAAGA"}
+	bins := LinearLags(5)
+
+	// a single block behaves like the genome.
+	for _, circular := range []bool{false, true} {
+		pt, _ := PartitionLengths([]int{len(genomes[0])}, circular)
+		got := CalcP2(genomes, bins, false, &SiteComparer{Partition: pt})
+		want := CalcP2(genomes, bins, circular, nil)
+		if !sameResults(got, want) {
+			t.Errorf("circular %v: P2 %v, want %v", circular, got, want)
+		}
+	}
+
+	// contigs of 5 and 7 sites have 12-2l linear pairs at lag l, and 12 circular ones.
+	for _, circular := range []bool{false, true} {
+		pt, _ := PartitionLengths([]int{5, 7}, circular)
+		for _, r := range CalcP2(genomes, bins, false, &SiteComparer{Partition: pt}) {
+			if r.Type != "P2" {
+				continue
+			}
+			want := 3 * (12 - 2*r.Lag)
+			if circular {
+				want = 3 * 12
+			}
+			if r.Sites != want {
+				t.Errorf("circular %v: %d site pairs at lag %d, want %d", circular, r.Sites, r.Lag, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,448 @@
+package biascorr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// The binary population format stores a file header, then one record
+// per population, then an index of record offsets for random access:
+//
+//	header:  magic "BCPF", uint16 version, uint16 reserved
+//	record:  byte 'R', uint32 payload length, payload
+//	index:   byte 'I', uint64 count, count uint64 record offsets
+//	trailer: uint64 index offset, magic "BCPX"
+//
+// A payload holds a binaryHeader, then each genome as 2-bit nucleotides
+// (A, C, G, T) followed by a side list of the sites holding other bytes,
+// such as gaps and ambiguous nucleotides, then the ranks, then optionally
+// uint32 count and count names as uint16 length and bytes.
+// Numbers are little endian.
+const (
+	binaryMagic        = "BCPF"
+	binaryTrailerMagic = "BCPX"
+	binaryVersion      = 1
+	binaryTrailerSize  = 12
+)
+
+// Rank encodings of the binary format.
+const (
+	ranksNone     = 0 // no ranks.
+	ranksTriangle = 1 // uint32 upper triangle of symmetric integer ranks with zero diagonal.
+	ranksFull     = 2 // float64 matrix.
+)
+
+// binaryHeader is the fixed part of a record payload.
+type binaryHeader struct {
+	Size, Length               uint32
+	MutationRate, TransferRate float64
+	FragLen, Generation        uint32
+	Genomes, GenomeLen         uint32
+	Ranks                      uint8
+}
+
+// nucleotideCodes maps the nucleotides stored in 2 bits to their codes.
+var nucleotideCodes = map[byte]byte{'A': 0, 'C': 1, 'G': 2, 'T': 3}
+
+// codeNucleotides maps 2-bit codes back to nucleotides.
+var codeNucleotides = []byte{'A', 'C', 'G', 'T'}
+
+// BinaryPopWriter writes populations in the binary format.
+type BinaryPopWriter struct {
+	w       io.Writer
+	offset  uint64
+	offsets []uint64
+	err     error
+}
+
+// NewBinaryPopWriter writes the file header and returns a BinaryPopWriter.
+func NewBinaryPopWriter(w io.Writer) *BinaryPopWriter {
+	bw := &BinaryPopWriter{w: w}
+	header := make([]byte, 8)
+	copy(header, binaryMagic)
+	binary.LittleEndian.PutUint16(header[4:], binaryVersion)
+	bw.write(header)
+	return bw
+}
+
+// write writes bytes, keeping the first error.
+func (bw *BinaryPopWriter) write(b []byte) {
+	if bw.err != nil {
+		return
+	}
+	_, bw.err = bw.w.Write(b)
+	bw.offset += uint64(len(b))
+}
+
+// Write writes a population.
+func (bw *BinaryPopWriter) Write(p Pop) error {
+	payload, err := encodeBinaryPop(p)
+	if err != nil {
+		return err
+	}
+	if uint64(len(payload)) > math.MaxUint32 {
+		return fmt.Errorf("population record of %d bytes exceeds the 4 GiB record limit", len(payload))
+	}
+	bw.offsets = append(bw.offsets, bw.offset)
+	head := make([]byte, 5)
+	head[0] = 'R'
+	binary.LittleEndian.PutUint32(head[1:], uint32(len(payload)))
+	bw.write(head)
+	bw.write(payload)
+	return bw.err
+}
+
+// Close writes the index and the trailer.
+// It does not close the underlying writer.
+func (bw *BinaryPopWriter) Close() error {
+	indexOffset := bw.offset
+	index := make([]byte, 9+8*len(bw.offsets))
+	index[0] = 'I'
+	binary.LittleEndian.PutUint64(index[1:], uint64(len(bw.offsets)))
+	for i, off := range bw.offsets {
+		binary.LittleEndian.PutUint64(index[9+8*i:], off)
+	}
+	bw.write(index)
+
+	trailer := make([]byte, binaryTrailerSize)
+	binary.LittleEndian.PutUint64(trailer, indexOffset)
+	copy(trailer[8:], binaryTrailerMagic)
+	bw.write(trailer)
+	return bw.err
+}
+
+// encodeBinaryPop returns the record payload of a population.
+func encodeBinaryPop(p Pop) ([]byte, error) {
+	if p.IsSparse() {
+		return nil, fmt.Errorf("sparse populations do not fit the binary format")
+	}
+	if err := CheckGenomeLengths(p.Genomes); err != nil {
+		return nil, err
+	}
+	for _, v := range []int{p.Size, p.Length, p.FragLen, p.Generation, len(p.Genomes)} {
+		if v < 0 || v > math.MaxUint32 {
+			return nil, fmt.Errorf("value %d does not fit the binary format", v)
+		}
+	}
+
+	h := binaryHeader{
+		Size:         uint32(p.Size),
+		Length:       uint32(p.Length),
+		MutationRate: p.MutationRate,
+		TransferRate: p.TransferRate,
+		FragLen:      uint32(p.FragLen),
+		Generation:   uint32(p.Generation),
+		Genomes:      uint32(len(p.Genomes)),
+		Ranks:        rankEncoding(p.Ranks, len(p.Genomes)),
+	}
+	if len(p.Genomes) > 0 {
+		h.GenomeLen = uint32(len(p.Genomes[0]))
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, h)
+	for _, g := range p.Genomes {
+		packed := make([]byte, (len(g)+3)/4)
+		others := []int{}
+		for k := 0; k < len(g); k++ {
+			code, found := nucleotideCodes[g[k]]
+			if !found {
+				others = append(others, k)
+			}
+			packed[k/4] |= code << uint(2*(k%4))
+		}
+		buf.Write(packed)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(others)))
+		for _, k := range others {
+			binary.Write(&buf, binary.LittleEndian, uint32(k))
+			buf.WriteByte(g[k])
+		}
+	}
+
+	switch h.Ranks {
+	case ranksTriangle:
+		for i := range p.Ranks {
+			for j := i + 1; j < len(p.Ranks); j++ {
+				binary.Write(&buf, binary.LittleEndian, uint32(p.Ranks[i][j]))
+			}
+		}
+	case ranksFull:
+		if len(p.Ranks) != len(p.Genomes) {
+			return nil, fmt.Errorf("%d rows of ranks for %d genomes", len(p.Ranks), len(p.Genomes))
+		}
+		for _, row := range p.Ranks {
+			if len(row) != len(p.Genomes) {
+				return nil, fmt.Errorf("a row of %d ranks for %d genomes", len(row), len(p.Genomes))
+			}
+			binary.Write(&buf, binary.LittleEndian, row)
+		}
+	}
+
+	if len(p.Names) > 0 {
+		binary.Write(&buf, binary.LittleEndian, uint32(len(p.Names)))
+		for _, name := range p.Names {
+			if len(name) > math.MaxUint16 {
+				return nil, fmt.Errorf("genome name of %d bytes does not fit the binary format", len(name))
+			}
+			binary.Write(&buf, binary.LittleEndian, uint16(len(name)))
+			buf.WriteString(name)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// rankEncoding returns the most compact lossless encoding of the ranks.
+func rankEncoding(ranks [][]float64, n int) uint8 {
+	if len(ranks) == 0 {
+		return ranksNone
+	}
+	if len(ranks) != n {
+		return ranksFull
+	}
+	for i := range ranks {
+		if len(ranks[i]) != n || ranks[i][i] != 0 {
+			return ranksFull
+		}
+		for j := i + 1; j < n; j++ {
+			v := ranks[i][j]
+			if v != ranks[j][i] || v < 0 || v > math.MaxUint32 || v != math.Trunc(v) {
+				return ranksFull
+			}
+		}
+	}
+	return ranksTriangle
+}
+
+// decodeBinaryPop decodes a record payload.
+func decodeBinaryPop(payload []byte) (Pop, error) {
+	r := bytes.NewReader(payload)
+	var h binaryHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return Pop{}, fmt.Errorf("record header: %v", err)
+	}
+
+	p := Pop{
+		Size:         int(h.Size),
+		Length:       int(h.Length),
+		MutationRate: h.MutationRate,
+		TransferRate: h.TransferRate,
+		FragLen:      int(h.FragLen),
+		Generation:   int(h.Generation),
+	}
+
+	n, length := int(h.Genomes), int(h.GenomeLen)
+	packed := make([]byte, (length+3)/4)
+	for i := 0; i < n; i++ {
+		if _, err := io.ReadFull(r, packed); err != nil {
+			return Pop{}, fmt.Errorf("genome %d: %v", i, err)
+		}
+		g := make([]byte, length)
+		for k := range g {
+			g[k] = codeNucleotides[(packed[k/4]>>uint(2*(k%4)))&3]
+		}
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return Pop{}, fmt.Errorf("genome %d: %v", i, err)
+		}
+		for c := uint32(0); c < count; c++ {
+			var k uint32
+			if err := binary.Read(r, binary.LittleEndian, &k); err != nil {
+				return Pop{}, fmt.Errorf("genome %d: %v", i, err)
+			}
+			b, err := r.ReadByte()
+			if err != nil {
+				return Pop{}, fmt.Errorf("genome %d: %v", i, err)
+			}
+			if int(k) >= length {
+				return Pop{}, fmt.Errorf("genome %d: site %d beyond length %d", i, k, length)
+			}
+			g[k] = b
+		}
+		p.Genomes = append(p.Genomes, string(g))
+	}
+
+	switch h.Ranks {
+	case ranksNone:
+	case ranksTriangle:
+		p.Ranks = make([][]float64, n)
+		for i := range p.Ranks {
+			p.Ranks[i] = make([]float64, n)
+		}
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				var v uint32
+				if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+					return Pop{}, fmt.Errorf("ranks: %v", err)
+				}
+				p.Ranks[i][j] = float64(v)
+				p.Ranks[j][i] = float64(v)
+			}
+		}
+	case ranksFull:
+		for i := 0; i < n; i++ {
+			row := make([]float64, n)
+			if err := binary.Read(r, binary.LittleEndian, row); err != nil {
+				return Pop{}, fmt.Errorf("ranks: %v", err)
+			}
+			p.Ranks = append(p.Ranks, row)
+		}
+	default:
+		return Pop{}, fmt.Errorf("unknown rank encoding %d", h.Ranks)
+	}
+
+	if r.Len() > 0 {
+		var count uint32
+		if err := binary.Read(r, binary.LittleEndian, &count); err != nil {
+			return Pop{}, fmt.Errorf("names: %v", err)
+		}
+		for c := uint32(0); c < count; c++ {
+			var size uint16
+			if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+				return Pop{}, fmt.Errorf("names: %v", err)
+			}
+			name := make([]byte, size)
+			if _, err := io.ReadFull(r, name); err != nil {
+				return Pop{}, fmt.Errorf("names: %v", err)
+			}
+			p.Names = append(p.Names, string(name))
+		}
+	}
+
+	return p, nil
+}
+
+// isBinaryPops returns true if the stream starts with the binary format magic.
+func isBinaryPops(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(binaryMagic))
+	return err == nil && string(magic) == binaryMagic
+}
+
+// readBinaryHeader reads and checks the file header.
+func readBinaryHeader(r io.Reader) error {
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return err
+	}
+	if string(header[:4]) != binaryMagic {
+		return fmt.Errorf("not a binary population file")
+	}
+	if v := binary.LittleEndian.Uint16(header[4:]); v != binaryVersion {
+		return fmt.Errorf("unsupported binary population version %d", v)
+	}
+	return nil
+}
+
+// readBinaryRecord reads the next record, returning io.EOF at the index.
+func readBinaryRecord(r io.Reader) (Pop, error) {
+	head := make([]byte, 5)
+	if _, err := io.ReadFull(r, head[:1]); err != nil {
+		return Pop{}, err
+	}
+	if head[0] == 'I' {
+		return Pop{}, io.EOF
+	}
+	if head[0] != 'R' {
+		return Pop{}, fmt.Errorf("unknown record tag %q", head[0])
+	}
+	if _, err := io.ReadFull(r, head[1:]); err != nil {
+		return Pop{}, err
+	}
+	payload := make([]byte, binary.LittleEndian.Uint32(head[1:]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return Pop{}, err
+	}
+	return decodeBinaryPop(payload)
+}
+
+// readBinaryIndex returns the record offsets of an uncompressed binary file.
+func readBinaryIndex(f *os.File) ([]uint64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() < 8+binaryTrailerSize {
+		return nil, fmt.Errorf("%s: too short for a binary population file", f.Name())
+	}
+	trailer := make([]byte, binaryTrailerSize)
+	if _, err := f.ReadAt(trailer, info.Size()-binaryTrailerSize); err != nil {
+		return nil, err
+	}
+	if string(trailer[8:]) != binaryTrailerMagic {
+		return nil, fmt.Errorf("%s: no index, the file may be compressed or truncated", f.Name())
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(trailer))
+	head := make([]byte, 9)
+	if _, err := f.ReadAt(head, indexOffset); err != nil {
+		return nil, err
+	}
+	if head[0] != 'I' {
+		return nil, fmt.Errorf("%s: bad index offset %d", f.Name(), indexOffset)
+	}
+	count := binary.LittleEndian.Uint64(head[1:])
+	if count > uint64(info.Size()) {
+		return nil, fmt.Errorf("%s: bad index count %d", f.Name(), count)
+	}
+	raw := make([]byte, 8*count)
+	if _, err := f.ReadAt(raw, indexOffset+9); err != nil {
+		return nil, err
+	}
+	offsets := make([]uint64, count)
+	for i := range offsets {
+		offsets[i] = binary.LittleEndian.Uint64(raw[8*i:])
+	}
+	return offsets, nil
+}
+
+// CountBinaryPops returns the number of populations in an uncompressed
+// binary population file, using its index.
+func CountBinaryPops(file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	if err := readBinaryHeader(f); err != nil {
+		return 0, fmt.Errorf("%s: %v", file, err)
+	}
+	offsets, err := readBinaryIndex(f)
+	return len(offsets), err
+}
+
+// ReadPopAt reads the i-th population of an uncompressed binary
+// population file, using its index.
+func ReadPopAt(file string, i int) (Pop, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Pop{}, err
+	}
+	defer f.Close()
+
+	if err := readBinaryHeader(f); err != nil {
+		return Pop{}, fmt.Errorf("%s: %v", file, err)
+	}
+	offsets, err := readBinaryIndex(f)
+	if err != nil {
+		return Pop{}, err
+	}
+	if i < 0 || i >= len(offsets) {
+		return Pop{}, fmt.Errorf("%s: no population %d of %d", file, i, len(offsets))
+	}
+	if _, err := f.Seek(int64(offsets[i]), io.SeekStart); err != nil {
+		return Pop{}, err
+	}
+	p, err := readBinaryRecord(bufio.NewReader(f))
+	if err != nil {
+		return Pop{}, fmt.Errorf("%s: population %d: %v", file, i, err)
+	}
+	p.Source = file
+	p.Index = i
+	return p, nil
+}
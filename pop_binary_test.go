@@ -0,0 +1,95 @@
+package biascorr
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testPops() []Pop {
+	return []Pop{
+		{
+			Size: 3, Length: 7, MutationRate: 1e-5, TransferRate: 2e-6, FragLen: 100, Generation: 30,
+			Genomes: []string{"ACGTACG", "ACNTa-G", "TTTTTTT"},
+			Ranks:   [][]float64{{0, 1, 2}, {1, 0, 2}, {2, 2, 0}},
+		},
+		{
+			Size: 2, Length: 5,
+			Genomes: []string{"ACGTA", "ACGTC"},
+			Ranks:   [][]float64{{0, 0.5}, {0.5, 0}},
+		},
+		{Size: 2, Length: 4, Genomes: []string{"GGGG", "GGGC"}, Names: []string{"E_coli K-12", "b"}},
+	}
+}
+
+func TestBinaryPopRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewBinaryPopWriter(&buf)
+	for _, p := range testPops() {
+		if err := bw.Write(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(t.TempDir(), "pops.bcp")
+	if err := os.WriteFile(file, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got := []Pop{}
+	read, errc := ReadPops(file, 10)
+	for p := range read {
+		if p.Source != file || p.Index != len(got) {
+			t.Errorf("population %d tagged %s %d", len(got), p.Source, p.Index)
+		}
+		got = append(got, untagged(p))
+	}
+	if err := <-errc; err != nil {
+		t.Error(err)
+	}
+	if !reflect.DeepEqual(got, testPops()) {
+		t.Errorf("ReadPops got %+v, want %+v", got, testPops())
+	}
+
+	n, err := CountBinaryPops(file)
+	if err != nil || n != 3 {
+		t.Errorf("CountBinaryPops = %d, %v, want 3", n, err)
+	}
+	for i, want := range testPops() {
+		p, err := ReadPopAt(file, i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(untagged(p), want) {
+			t.Errorf("ReadPopAt(%d) = %+v, want %+v", i, p, want)
+		}
+	}
+	if _, err := ReadPopAt(file, 3); err == nil {
+		t.Error("ReadPopAt beyond the last population succeeded")
+	}
+}
+
+// untagged returns the population without its source and index.
+func untagged(p Pop) Pop {
+	p.Source = ""
+	p.Index = 0
+	return p
+}
+
+func TestRankEncoding(t *testing.T) {
+	pops := testPops()
+	if e := rankEncoding(pops[0].Ranks, 3); e != ranksTriangle {
+		t.Errorf("symmetric integer ranks encoded as %d", e)
+	}
+	if e := rankEncoding(pops[1].Ranks, 2); e != ranksFull {
+		t.Errorf("fractional ranks encoded as %d", e)
+	}
+	if e := rankEncoding(nil, 2); e != ranksNone {
+		t.Errorf("no ranks encoded as %d", e)
+	}
+}
@@ -0,0 +1,327 @@
+package biascorr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Selection selects population records while they are read.
+// Invalid records are dropped or abort reading, the filter is applied
+// next, then Skip and Every count the matching records, and at most
+// Max populations are kept.
+type Selection struct {
+	Skip        int     // number of matching records skipped.
+	Every       int     // keep every Every-th record after skipping; 0 keeps all.
+	Max         int     // maximum number of populations; 0 keeps all.
+	Filter      *Filter // if not nil, keep only the matching records.
+	SkipInvalid bool    // skip and log invalid records instead of stopping with an error.
+	RefLength   int     // length of VCF chromosomes without a ##contig length, and of ms replicates.
+
+	// Check, if not nil, further checks valid records, such as Sampler.Check,
+	// whose errors are handled like those of ValidatePop.
+	Check func(p Pop) error
+}
+
+// Filter is a parsed expression over the fields of a Pop, such as
+// "TransferRate > 1e-4 && Generation >= 10000". Expressions combine
+// numbers and the fields in popFields with arithmetic (+ - * /),
+// comparisons (< <= > >= == !=), logic (&& || !) and parentheses.
+type Filter struct {
+	expr string
+	eval func(p Pop) float64
+}
+
+// popFields are the fields a Filter can use.
+var popFields = map[string]func(p Pop) float64{
+	"Size":         func(p Pop) float64 { return float64(p.Size) },
+	"Length":       func(p Pop) float64 { return float64(p.Length) },
+	"MutationRate": func(p Pop) float64 { return p.MutationRate },
+	"TransferRate": func(p Pop) float64 { return p.TransferRate },
+	"FragLen":      func(p Pop) float64 { return float64(p.FragLen) },
+	"Generation":   func(p Pop) float64 { return float64(p.Generation) },
+	"Genomes":      func(p Pop) float64 { return float64(p.NumGenomes()) },
+	"Index":        func(p Pop) float64 { return float64(p.Index) },
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expr string) (*Filter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	parser := filterParser{tokens: tokens}
+	eval, err := parser.or()
+	if err == nil && parser.pos < len(tokens) {
+		err = fmt.Errorf("unexpected %q", tokens[parser.pos])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %v", expr, err)
+	}
+	return &Filter{expr: expr, eval: eval}, nil
+}
+
+// Match returns true if the population matches the filter.
+func (f *Filter) Match(p Pop) bool {
+	return f.eval(p) != 0
+}
+
+// String returns the expression.
+func (f *Filter) String() string {
+	return f.expr
+}
+
+// keep returns true if the n-th matching record is selected.
+func (s Selection) keep(n int) bool {
+	if n < s.Skip {
+		return false
+	}
+	return s.Every <= 1 || (n-s.Skip)%s.Every == 0
+}
+
+// Selected returns the number of populations selected from n records,
+// if every record matches and is valid.
+func (s Selection) Selected(n int) int {
+	k := 0
+	if n > s.Skip {
+		k = n - s.Skip
+		if s.Every > 1 {
+			k = (k + s.Every - 1) / s.Every
+		}
+	}
+	if s.Max > 0 && k > s.Max {
+		k = s.Max
+	}
+	return k
+}
+
+// full returns true if n populations are enough.
+func (s Selection) full(n int) bool {
+	return s.Max > 0 && n >= s.Max
+}
+
+// filterOperators are the operators of filters, longest first.
+var filterOperators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "+", "-", "*", "/", "(", ")"}
+
+// tokenizeFilter splits an expression into numbers, names and operators.
+func tokenizeFilter(expr string) ([]string, error) {
+	tokens := []string{}
+	for i := 0; i < len(expr); {
+		c := rune(expr[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(expr) && (unicode.IsDigit(rune(expr[j])) || expr[j] == '.') {
+				j++
+			}
+			if j < len(expr) && (expr[j] == 'e' || expr[j] == 'E') {
+				j++
+				if j < len(expr) && (expr[j] == '+' || expr[j] == '-') {
+					j++
+				}
+				for j < len(expr) && unicode.IsDigit(rune(expr[j])) {
+					j++
+				}
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(expr) && (unicode.IsLetter(rune(expr[j])) || unicode.IsDigit(rune(expr[j])) || expr[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, expr[i:j])
+			i = j
+		default:
+			found := false
+			for _, op := range filterOperators {
+				if strings.HasPrefix(expr[i:], op) {
+					tokens = append(tokens, op)
+					i += len(op)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character %q", c)
+			}
+		}
+	}
+	return tokens, nil
+}
+
+// filterParser parses tokens by recursive descent into evaluators,
+// where comparisons and logic give 1 for true and 0 for false.
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+type evaluator func(p Pop) float64
+
+// accept consumes the next token if it is one of ops.
+func (fp *filterParser) accept(ops ...string) (string, bool) {
+	if fp.pos >= len(fp.tokens) {
+		return "", false
+	}
+	for _, op := range ops {
+		if fp.tokens[fp.pos] == op {
+			fp.pos++
+			return op, true
+		}
+	}
+	return "", false
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// or parses: and ('||' and)*
+func (fp *filterParser) or() (evaluator, error) {
+	left, err := fp.and()
+	for err == nil {
+		if _, ok := fp.accept("||"); !ok {
+			break
+		}
+		var right evaluator
+		right, err = fp.and()
+		l := left
+		left = func(p Pop) float64 { return truth(l(p) != 0 || right(p) != 0) }
+	}
+	return left, err
+}
+
+// and parses: not ('&&' not)*
+func (fp *filterParser) and() (evaluator, error) {
+	left, err := fp.not()
+	for err == nil {
+		if _, ok := fp.accept("&&"); !ok {
+			break
+		}
+		var right evaluator
+		right, err = fp.not()
+		l := left
+		left = func(p Pop) float64 { return truth(l(p) != 0 && right(p) != 0) }
+	}
+	return left, err
+}
+
+// not parses: '!' not | comparison
+func (fp *filterParser) not() (evaluator, error) {
+	if _, ok := fp.accept("!"); ok {
+		e, err := fp.not()
+		return func(p Pop) float64 { return truth(e(p) == 0) }, err
+	}
+	return fp.comparison()
+}
+
+// comparison parses: sum (op sum)?
+func (fp *filterParser) comparison() (evaluator, error) {
+	left, err := fp.sum()
+	if err != nil {
+		return nil, err
+	}
+	op, ok := fp.accept("<", "<=", ">", ">=", "==", "!=")
+	if !ok {
+		return left, nil
+	}
+	right, err := fp.sum()
+	if err != nil {
+		return nil, err
+	}
+	compare := map[string]func(a, b float64) bool{
+		"<":  func(a, b float64) bool { return a < b },
+		"<=": func(a, b float64) bool { return a <= b },
+		">":  func(a, b float64) bool { return a > b },
+		">=": func(a, b float64) bool { return a >= b },
+		"==": func(a, b float64) bool { return a == b },
+		"!=": func(a, b float64) bool { return a != b },
+	}[op]
+	return func(p Pop) float64 { return truth(compare(left(p), right(p))) }, nil
+}
+
+// sum parses: term (('+'|'-') term)*
+func (fp *filterParser) sum() (evaluator, error) {
+	left, err := fp.term()
+	for err == nil {
+		op, ok := fp.accept("+", "-")
+		if !ok {
+			break
+		}
+		var right evaluator
+		right, err = fp.term()
+		l := left
+		if op == "+" {
+			left = func(p Pop) float64 { return l(p) + right(p) }
+		} else {
+			left = func(p Pop) float64 { return l(p) - right(p) }
+		}
+	}
+	return left, err
+}
+
+// term parses: unary (('*'|'/') unary)*
+func (fp *filterParser) term() (evaluator, error) {
+	left, err := fp.unary()
+	for err == nil {
+		op, ok := fp.accept("*", "/")
+		if !ok {
+			break
+		}
+		var right evaluator
+		right, err = fp.unary()
+		l := left
+		if op == "*" {
+			left = func(p Pop) float64 { return l(p) * right(p) }
+		} else {
+			left = func(p Pop) float64 { return l(p) / right(p) }
+		}
+	}
+	return left, err
+}
+
+// unary parses: '-' unary | primary
+func (fp *filterParser) unary() (evaluator, error) {
+	if _, ok := fp.accept("-"); ok {
+		e, err := fp.unary()
+		return func(p Pop) float64 { return -e(p) }, err
+	}
+	return fp.primary()
+}
+
+// primary parses: number | field | '(' or ')'
+func (fp *filterParser) primary() (evaluator, error) {
+	if fp.pos >= len(fp.tokens) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	if _, ok := fp.accept("("); ok {
+		e, err := fp.or()
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := fp.accept(")"); !ok {
+			return nil, fmt.Errorf("missing )")
+		}
+		return e, nil
+	}
+
+	token := fp.tokens[fp.pos]
+	fp.pos++
+	if field, found := popFields[token]; found {
+		return field, nil
+	}
+	if v, err := strconv.ParseFloat(token, 64); err == nil {
+		return func(Pop) float64 { return v }, nil
+	}
+	if unicode.IsLetter(rune(token[0])) {
+		return nil, fmt.Errorf("unknown field %s", token)
+	}
+	return nil, fmt.Errorf("unexpected %q", token)
+}
@@ -0,0 +1,92 @@
+package biascorr
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	p := Pop{Size: 100, Length: 1000, MutationRate: 1e-5, TransferRate: 2e-4, FragLen: 50, Generation: 20000}
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{"TransferRate > 1e-4 && Generation >= 10000", true},
+		{"TransferRate > 1e-4 && Generation >= 30000", false},
+		{"TransferRate < 1e-4 || Size == 100", true},
+		{"!(Size == 100)", false},
+		{"TransferRate / MutationRate == 20", true},
+		{"Size * 2 - 1 >= 199 && -FragLen < 0", true},
+		{"1 < 2 && (2 < 1 || Length != 1000)", false},
+	}
+	for _, test := range tests {
+		f, err := ParseFilter(test.expr)
+		if err != nil {
+			t.Errorf("%s: %v", test.expr, err)
+			continue
+		}
+		if f.Match(p) != test.match {
+			t.Errorf("%s matched %t", test.expr, !test.match)
+		}
+	}
+
+	for _, expr := range []string{"", "Size >", "Rate > 1", "(Size > 1", "Size > 1)", "Size $ 1"} {
+		if _, err := ParseFilter(expr); err == nil {
+			t.Errorf("bad filter %q was accepted", expr)
+		}
+	}
+}
+
+func TestReadSelectedPops(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{}
+	for i := 0; i < 2; i++ {
+		c := make(chan Pop)
+		go func() {
+			defer close(c)
+			for g := 0; g < 5; g++ {
+				c <- Pop{Size: 2, Length: 2, Generation: 5*i + g, Genomes: []string{"AC", "AG"}}
+			}
+		}()
+		file := filepath.Join(dir, []string{"a.json", "b.bcp"}[i])
+		if err := WritePops(c, file); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+	middle, _ := ParseFilter("Generation >= 4 && Generation < 9")
+	tests := []struct {
+		sel  Selection
+		want []int
+	}{
+		{Selection{}, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{Selection{Max: 3}, []int{0, 1, 2}},
+		{Selection{Skip: 3, Every: 2}, []int{3, 5, 7, 9}},
+		{Selection{Skip: 3, Every: 3, Max: 2}, []int{3, 6}},
+		{Selection{Filter: middle}, []int{4, 5, 6, 7, 8}},
+		{Selection{Filter: middle, Skip: 1, Every: 2}, []int{5, 7}},
+	}
+	for _, test := range tests {
+		got := []int{}
+		pops, errc := ReadSelectedPops(files, test.sel)
+		for p := range pops {
+			got = append(got, p.Generation)
+		}
+		if err := <-errc; err != nil {
+			t.Errorf("%+v: %v", test.sel, err)
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%+v: got %v, want %v", test.sel, got, test.want)
+			continue
+		}
+		if n := test.sel.Selected(10); test.sel.Filter == nil && n != len(got) {
+			t.Errorf("%+v: %d selected, want %d", test.sel, n, len(got))
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%+v: got %v, want %v", test.sel, got, test.want)
+				break
+			}
+		}
+	}
+}
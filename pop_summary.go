@@ -0,0 +1,58 @@
+package biascorr
+
+// PopSummary summarises the genomes of a population.
+type PopSummary struct {
+	Params
+	Genomes     int
+	Length      int
+	Segregating int     // number of segregating sites.
+	Diversity   float64 // mean fraction of differing sites between genome pairs.
+	Missing     float64 // fraction of gaps and ambiguous nucleotides.
+	HasRanks    bool
+}
+
+// SummarizePop returns the summary of a population.
+func SummarizePop(p Pop) PopSummary {
+	s := PopSummary{Params: p.Params(), Genomes: p.NumGenomes()}
+	s.HasRanks = len(p.Ranks) == s.Genomes && len(p.Ranks) > 0
+	if s.Genomes == 0 {
+		return s
+	}
+	s.Length = p.GenomeLength()
+	if p.IsSparse() {
+		summarizeSparse(p, &s)
+		return s
+	}
+
+	missing := 0
+	for k := 0; k < s.Length; k++ {
+		first := byte(0)
+		segregating := false
+		for _, g := range p.Genomes {
+			if IsMissing(g[k]) {
+				missing++
+			} else if first == 0 {
+				first = g[k]
+			} else if g[k] != first {
+				segregating = true
+			}
+		}
+		if segregating {
+			s.Segregating++
+		}
+	}
+	s.Missing = float64(missing) / float64(s.Length*len(p.Genomes))
+
+	pairs := 0
+	for i := 0; i < len(p.Genomes); i++ {
+		for j := i + 1; j < len(p.Genomes); j++ {
+			s.Diversity += CompareGenomes(p.Genomes[i], p.Genomes[j], nil)
+			pairs++
+		}
+	}
+	if pairs > 0 {
+		s.Diversity /= float64(pairs)
+	}
+
+	return s
+}
@@ -0,0 +1,117 @@
+package biascorr
+
+import "fmt"
+
+// PopError reports an invalid field of a population record.
+type PopError struct {
+	Source string // input of the record.
+	Index  int    // record index in the input.
+	Field  string // Pop field at fault.
+	Err    error
+}
+
+func (e *PopError) Error() string {
+	return fmt.Sprintf("%s population %d: %s: %v", e.Source, e.Index, e.Field, e.Err)
+}
+
+func (e *PopError) Unwrap() error {
+	return e.Err
+}
+
+// ValidatePop checks that a population record is consistent:
+// Size is the number of genomes, every genome has Length bases
+// of the allowed alphabet, or sorted substitutions of the allowed
+// alphabet within Length sites for sparse populations, Names,
+// if present, are distinct names of the genomes, and Ranks,
+// if present, is a square symmetric matrix over the genomes.
+// It returns a *PopError.
+func ValidatePop(p Pop) error {
+	fail := func(field, format string, a ...interface{}) error {
+		return &PopError{Source: p.Source, Index: p.Index, Field: field, Err: fmt.Errorf(format, a...)}
+	}
+
+	n := p.NumGenomes()
+	if p.Size != n {
+		return fail("Size", "%d, but there are %d genomes", p.Size, n)
+	}
+	if len(p.Genomes) > 0 && len(p.Subs) > 0 {
+		return fail("Subs", "given besides Genomes")
+	}
+	for i, subs := range p.Subs {
+		if err := checkSubs(subs, p.Length); err != nil {
+			return fail("Subs", "genome %d: %v", i, err)
+		}
+	}
+	if err := checkSubs(p.Ref, p.Length); err != nil {
+		return fail("Ref", "%v", err)
+	}
+	for i, g := range p.Genomes {
+		if len(g) != p.Length {
+			return fail("Genomes", "genome %d has length %d, but Length is %d", i, len(g), p.Length)
+		}
+		for k := 0; k < len(g); k++ {
+			if !IsAllowed(g[k]) {
+				return fail("Genomes", "genome %d has %q at site %d", i, g[k], k)
+			}
+		}
+	}
+
+	if len(p.Names) > 0 {
+		if len(p.Names) != n {
+			return fail("Names", "%d names for %d genomes", len(p.Names), n)
+		}
+		seen := make(map[string]bool)
+		for i, name := range p.Names {
+			if name == "" || seen[name] {
+				return fail("Names", "genome %d has an empty or repeated name %q", i, name)
+			}
+			seen[name] = true
+		}
+	}
+
+	if len(p.Ranks) == 0 {
+		return nil
+	}
+	if len(p.Ranks) != n {
+		return fail("Ranks", "%d rows for %d genomes", len(p.Ranks), n)
+	}
+	for i := range p.Ranks {
+		if len(p.Ranks[i]) != n {
+			return fail("Ranks", "row %d has %d columns for %d genomes", i, len(p.Ranks[i]), n)
+		}
+	}
+	for i := range p.Ranks {
+		for j := i + 1; j < len(p.Ranks); j++ {
+			if p.Ranks[i][j] != p.Ranks[j][i] {
+				return fail("Ranks", "not symmetric at (%d, %d): %g and %g", i, j, p.Ranks[i][j], p.Ranks[j][i])
+			}
+		}
+	}
+	return nil
+}
+
+// checkSubs returns an error unless the substitutions are sorted,
+// of the allowed alphabet and within length sites.
+func checkSubs(subs Subs, length int) error {
+	for k, s := range subs {
+		switch {
+		case s.Pos < 0 || s.Pos >= length:
+			return fmt.Errorf("site %d beyond Length %d", s.Pos, length)
+		case k > 0 && s.Pos <= subs[k-1].Pos:
+			return fmt.Errorf("site %d not after site %d", s.Pos, subs[k-1].Pos)
+		case !IsAllowed(s.A):
+			return fmt.Errorf("%q at site %d", s.A, s.Pos)
+		}
+	}
+	return nil
+}
+
+// IsAllowed returns true if b is a nucleotide, an IUPAC ambiguity code,
+// in either case, or a gap ('-', '.') or unknown base ('?').
+func IsAllowed(b byte) bool {
+	switch b | 0x20 {
+	case 'a', 'c', 'g', 't', 'u', 'r', 'y', 's', 'w', 'k', 'm', 'b', 'd', 'h', 'v', 'n':
+		return true
+	}
+	return b == '-' || b == '.' || b == '?'
+}
@@ -0,0 +1,110 @@
+package biascorr
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidatePop(t *testing.T) {
+	for i, p := range testPops() {
+		if err := ValidatePop(p); err != nil {
+			t.Errorf("population %d: %v", i, err)
+		}
+	}
+
+	valid := func() Pop {
+		return Pop{
+			Source: "pops.json", Index: 4, Size: 2, Length: 3,
+			Genomes: []string{"ACG", "ACT"},
+			Ranks:   [][]float64{{0, 1}, {1, 0}},
+		}
+	}
+	tests := []struct {
+		field  string
+		modify func(p *Pop)
+	}{
+		{"Size", func(p *Pop) { p.Size = 3 }},
+		{"Genomes", func(p *Pop) { p.Length = 4 }},
+		{"Genomes", func(p *Pop) { p.Genomes[1] = "AC" }},
+		{"Genomes", func(p *Pop) { p.Genomes[1] = "AXT" }},
+		{"Names", func(p *Pop) { p.Names = []string{"a"} }},
+		{"Names", func(p *Pop) { p.Names = []string{"a", "a"} }},
+		{"Ranks", func(p *Pop) { p.Ranks = p.Ranks[:1] }},
+		{"Ranks", func(p *Pop) { p.Ranks[1] = []float64{1} }},
+		{"Ranks", func(p *Pop) { p.Ranks[1][0] = 2 }},
+	}
+	for _, test := range tests {
+		p := valid()
+		test.modify(&p)
+		var perr *PopError
+		if err := ValidatePop(p); !errors.As(err, &perr) {
+			t.Errorf("%s: got %v", test.field, err)
+		} else if perr.Field != test.field || perr.Index != 4 || !strings.HasPrefix(err.Error(), "pops.json population 4: "+test.field) {
+			t.Errorf("%s: got %v", test.field, err)
+		}
+	}
+}
+
+func TestReadSkipsInvalidPops(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "pops.json")
+	content := `{"Size":2,"Length":2,"Genomes":["AC","AG"]}
+{"Size":3,"Length":2,"Genomes":["AC","AG"]}
+{"Size":2,"Length":2,"Genomes":["AC","TG"]}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// readPops returns the indices of the records read, and the error.
+	readPops := func(sel Selection) ([]int, error) {
+		indices := []int{}
+		pops, errc := ReadSelectedPops([]string{file}, sel)
+		for p := range pops {
+			indices = append(indices, p.Index)
+		}
+		return indices, <-errc
+	}
+
+	indices, err := readPops(Selection{SkipInvalid: true})
+	if err != nil || len(indices) != 2 || indices[0] != 0 || indices[1] != 2 {
+		t.Errorf("read records %v, %v, want [0 2]", indices, err)
+	}
+	// without skipping, reading stops at the invalid record.
+	indices, err = readPops(Selection{})
+	var perr *PopError
+	if !errors.As(err, &perr) || perr.Index != 1 || len(indices) != 1 {
+		t.Errorf("read records %v, %v, want [0] and an error of record 1", indices, err)
+	}
+	// records the sampler cannot use are skipped the same way.
+	content += `{"Size":3,"Length":2,"Genomes":["AC","AG","AT"]}
+`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := Sampler{ClusterSize: 3, Repeat: 1, ByRandom: true}
+	indices, err = readPops(Selection{SkipInvalid: true, Check: s.Check})
+	if err != nil || len(indices) != 1 || indices[0] != 3 {
+		t.Errorf("read records %v, %v, want [3]", indices, err)
+	}
+
+	// malformed JSON records are skipped too, and reading goes on after them.
+	content = `{"Size":2,"Length":2,"Genomes":["AC","AG"]}
+{"Size":2,"Length":2,"Genomes":["AC",
+{"Size":"two","Length":2,"Genomes":["AC","AG"]}
+{"Size":2,"Length":2,"Genomes":["AC","TG"]}
+{"Size":2,"Length":2,"Genomes":["AC","TT"]`
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	indices, err = readPops(Selection{SkipInvalid: true})
+	if err != nil || len(indices) != 2 || indices[0] != 0 || indices[1] != 3 {
+		t.Errorf("read records %v, %v, want [0 3]", indices, err)
+	}
+	indices, err = readPops(Selection{})
+	if !errors.As(err, &perr) || perr.Index != 1 || perr.Field != "JSON" || len(indices) != 1 {
+		t.Errorf("read records %v, %v, want [0] and a JSON error of record 1", indices, err)
+	}
+}
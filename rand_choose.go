@@ -1,15 +1,25 @@
-package main
+package biascorr
 
 import (
 	"math/rand"
 )
 
-func randChooseClusters(p Pop, clusterSize int, num int) (clusters [][]string) {
+// RandChooseClusters returns num clusters of clusterSize genomes
+// sampled randomly with replacement.
+func RandChooseClusters(p Pop, clusterSize int, num int) (clusters [][]string) {
+	for _, indices := range randChooseIndices(p.NumGenomes(), clusterSize, num) {
+		clusters = append(clusters, p.genomesAt(indices))
+	}
+	return clusters
+}
+
+// randChooseIndices returns num clusters of clusterSize indices
+// of n genomes sampled randomly with replacement.
+func randChooseIndices(n int, clusterSize int, num int) (clusters [][]int) {
 	for i := 0; i < num; i++ {
-		cluster := []string{}
+		cluster := []int{}
 		for k := 0; k < clusterSize; k++ {
-			r := rand.Intn(p.Size)
-			cluster = append(cluster, p.Genomes[r])
+			cluster = append(cluster, rand.Intn(n))
 		}
 		clusters = append(clusters, cluster)
 	}
@@ -1,10 +1,12 @@
-package main
+package biascorr
 
 import (
-	"compress/gzip"
+	"bufio"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"os"
+	"log"
 )
 
 // Pop stores a population simulation results.
@@ -15,43 +17,209 @@ type Pop struct {
 	Generation                 int
 	Genomes                    []string
 	Ranks                      [][]float64
+	Names                      []string `json:",omitempty"` // optional genome names.
+
+	// Subs and Ref hold sparse populations, which have no Genomes:
+	// the sorted substitutions of each genome against a reference
+	// of Length sites, where missing genotypes are N, and the
+	// reference alleles at the sites of any substitution.
+	Subs []Subs `json:",omitempty"`
+	Ref  Subs   `json:",omitempty"`
+
+	Source string `json:"-"` // input the population was read from.
+	Index  int    `json:"-"` // record index in the input.
+}
+
+// GenomeNames returns the names of the genomes,
+// or their indices if they have no names.
+func (p Pop) GenomeNames() []string {
+	if len(p.Names) > 0 {
+		return p.Names
+	}
+	return indexNames(p.NumGenomes())
+}
+
+// ReadPops reads at most max populations from a JSON or binary file,
+// see ReadPopFiles.
+func ReadPops(file string, max int) (chan Pop, chan error) {
+	return ReadPopFiles([]string{file}, max)
 }
 
-func readPops(file string, max int) chan Pop {
+// ReadPopFiles reads at most max populations, or all if max is 0,
+// from JSON or binary files in order, see ReadSelectedPops.
+func ReadPopFiles(files []string, max int) (chan Pop, chan error) {
+	return ReadSelectedPops(files, Selection{Max: max})
+}
+
+// ReadSelectedPops reads the selected populations from JSON, binary, VCF or ms files
+// in order, each of which may be Stdin and may be compressed, see OpenInput.
+// Records are counted across files when skipping.
+// Each population is tagged with its file and record index,
+// and validated by ValidatePop and Selection.Check.
+// Reading stops at the first error, unless the record is skipped as invalid,
+// and the error is sent on the error channel once the populations are closed.
+// The error channel is then closed, so receiving from it gives nil
+// if every file was read.
+func ReadSelectedPops(files []string, sel Selection) (chan Pop, chan error) {
 	c := make(chan Pop, 20)
+	errc := make(chan error, 1)
 	go func() {
-		defer close(c)
-		f, err := os.Open(file)
+		defer close(errc)
+		err := readSelectedPops(files, sel, c)
+		close(c)
 		if err != nil {
-			panic(err)
+			errc <- err
 		}
-		defer f.Close()
+	}()
+	return c, errc
+}
 
-		var decoder *json.Decoder
-		appdix := file[len(file)-3:]
-		if appdix == ".gz" {
-			r, err := gzip.NewReader(f)
+// readSelectedPops sends the populations of ReadSelectedPops to c.
+func readSelectedPops(files []string, sel Selection, c chan Pop) error {
+	matched, sent := 0, 0
+	for _, file := range files {
+		if sel.full(sent) {
+			break
+		}
+		var invalid error
+		err := readPopFile(file, sel.RefLength, func(p Pop, err error) bool {
+			if err == nil {
+				err = ValidatePop(p)
+			}
+			if err == nil && sel.Check != nil {
+				err = sel.Check(p)
+			}
 			if err != nil {
-				panic(err)
+				if !sel.SkipInvalid {
+					invalid = err
+					return false
+				}
+				log.Printf("Skipping invalid record: %v", err)
+				return true
+			}
+			if sel.Filter != nil && !sel.Filter.Match(p) {
+				return true
 			}
-			defer r.Close()
-			decoder = json.NewDecoder(r)
-		} else {
-			decoder = json.NewDecoder(f)
+			matched++
+			if !sel.keep(matched - 1) {
+				return true
+			}
+			c <- p
+			sent++
+			return !sel.full(sent)
+		})
+		if err != nil {
+			return err
 		}
+		if invalid != nil {
+			return invalid
+		}
+	}
+	return nil
+}
 
-		count := 0
-		for count < max {
-			var p Pop
-			if err := decoder.Decode(&p); err != nil {
-				if err != io.EOF {
-					panic(err)
-				}
+// readPopFile passes the populations of a file to send
+// until it returns false. Malformed JSON records are passed as
+// a *PopError, and reading goes on from the next line.
+// VCF chromosomes without a ##contig length and ms replicates
+// have refLength sites, see ReadVCF and ReadMS.
+func readPopFile(file string, refLength int, send func(p Pop, err error) bool) error {
+	f, err := OpenInput(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	var next func() (Pop, error)
+	if isBinaryPops(br) {
+		if err := readBinaryHeader(br); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		next = func() (Pop, error) { return readBinaryRecord(br) }
+	} else if isVCF(br) {
+		next = newVCFReader(br, refLength).next
+	} else if isMS(br) {
+		next = newMSReader(br, refLength).next
+	} else {
+		next = newJSONReader(br).next
+	}
+
+	for count := 0; ; count++ {
+		p, err := next()
+		var jerr *jsonError
+		if errors.As(err, &jerr) {
+			if !send(Pop{}, &PopError{Source: file, Index: count, Field: "JSON", Err: jerr.err}) {
+				return nil
+			}
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("%s population %d: %v", file, count, err)
+			}
+			return nil
+		}
+		p.Source = file
+		p.Index = count
+		if !send(p, nil) {
+			return nil
+		}
+	}
+}
+
+// jsonReader reads a stream of JSON records, one per line as written by
+// WritePops, which may also span lines.
+type jsonReader struct {
+	r       *bufio.Reader
+	decoder *json.Decoder
+}
+
+func newJSONReader(r *bufio.Reader) *jsonReader {
+	return &jsonReader{r: r, decoder: json.NewDecoder(r)}
+}
+
+// jsonError is a malformed JSON record, after which reading can go on.
+type jsonError struct {
+	err error
+}
+
+func (e *jsonError) Error() string {
+	return e.err.Error()
+}
+
+// next returns the next record, or io.EOF. If the record is not
+// a population, it returns a *jsonError, and if it is not JSON either,
+// it skips the rest of the line where it starts.
+func (jr *jsonReader) next() (Pop, error) {
+	var raw json.RawMessage
+	if err := jr.decoder.Decode(&raw); err != nil {
+		if err == io.EOF {
+			return Pop{}, err
+		}
+		var serr *json.SyntaxError
+		if !errors.As(err, &serr) && err != io.ErrUnexpectedEOF {
+			return Pop{}, err
+		}
+		// the decoder cannot go on, so read on with a new one
+		// after the line of the record.
+		r := bufio.NewReader(io.MultiReader(jr.decoder.Buffered(), jr.r))
+		for {
+			b, rerr := r.ReadByte()
+			if rerr != nil || (b != ' ' && b != '\t' && b != '\r' && b != '\n') {
 				break
 			}
-			c <- p
-			count++
 		}
-	}()
-	return c
+		if _, rerr := r.ReadString('\n'); rerr != nil && rerr != io.EOF {
+			return Pop{}, rerr
+		}
+		jr.r = r
+		jr.decoder = json.NewDecoder(r)
+		return Pop{}, &jsonError{err}
+	}
+	p := Pop{}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return Pop{}, &jsonError{err}
+	}
+	return p, nil
 }
@@ -0,0 +1,145 @@
+package biascorr
+
+import "fmt"
+
+// Sampler chooses clusters of genomes from populations.
+type Sampler struct {
+	ClusterSize int
+	Repeat      int
+	ByCoalTime  bool // cluster by coalescent ranks instead of differing sites, see byCoalTime.
+	ByRandom    bool // choose genomes randomly instead of by clusters.
+	ByClade     bool // choose clades of ClusterSize tips of the tree.
+	Mix         int  // replace Mix genomes besides the central one by random genomes.
+	Comparer    *SiteComparer
+
+	// Infer and Tree provide coalescent ranks, see WithRanks,
+	// and the tree of clades, which is built by Infer if Tree is nil.
+	Infer RankMethod
+	Tree  *Tree
+}
+
+// Validate returns an error if the options contradict each other.
+func (s Sampler) Validate() error {
+	if s.ClusterSize < 2 {
+		return fmt.Errorf("cluster size must be at least 2, got %d", s.ClusterSize)
+	}
+	if s.Repeat < 1 {
+		return fmt.Errorf("repeat must be at least 1, got %d", s.Repeat)
+	}
+	if s.Mix < 0 {
+		return fmt.Errorf("mix must not be negative, got %d", s.Mix)
+	}
+	if s.ByClade && s.ByRandom {
+		return fmt.Errorf("genomes are chosen by clades or by random, not both")
+	}
+	if s.ByClade && s.Tree == nil && s.Infer == RanksGiven {
+		return fmt.Errorf("clades require a tree or a method to build one")
+	}
+	if s.ByRandom && s.Mix > 0 {
+		return fmt.Errorf("mixing applies only to clustered samples, not random ones")
+	}
+	if s.Mix >= s.ClusterSize {
+		return fmt.Errorf("mix (%d) must be smaller than the cluster size (%d)", s.Mix, s.ClusterSize)
+	}
+	return nil
+}
+
+// Check returns a *PopError if clusters cannot be chosen from the population.
+// It serves as Selection.Check, so that such records are skipped or abort
+// reading like invalid ones.
+func (s Sampler) Check(p Pop) error {
+	if p.NumGenomes() < s.ClusterSize {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Genomes",
+			Err: fmt.Errorf("%d genomes are fewer than the cluster size %d", p.NumGenomes(), s.ClusterSize)}
+	}
+	if s.needsRanks(p) && len(p.Ranks) == 0 && s.Infer == RanksGiven && s.Tree == nil {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Ranks", Err: fmt.Errorf("no coalescent ranks to cluster by")}
+	}
+	if !s.ByRandom && !s.ByClade && p.NumGenomes() < s.Repeat {
+		return &PopError{Source: p.Source, Index: p.Index, Field: "Genomes",
+			Err: fmt.Errorf("%d genomes are fewer than the %d clusters, which are centred on distinct genomes", p.NumGenomes(), s.Repeat)}
+	}
+	return nil
+}
+
+// Ranked returns the population with the coalescent ranks
+// to cluster by, see WithRanks.
+func (s Sampler) Ranked(p Pop) (Pop, error) {
+	if !s.needsRanks(p) {
+		return p, nil
+	}
+	return WithRanks(p, s.Infer, s.Tree, s.Comparer)
+}
+
+// needsRanks returns true if clusters of the population are chosen
+// by coalescent ranks.
+func (s Sampler) needsRanks(p Pop) bool {
+	return !s.ByRandom && !s.ByClade && s.byCoalTime(p)
+}
+
+// byCoalTime returns true if the population is clustered by coalescent ranks.
+// Sparse populations without ranks to give or infer, such as those read
+// from VCF or ms output, are clustered by differing sites instead.
+func (s Sampler) byCoalTime(p Pop) bool {
+	if !s.ByCoalTime {
+		return false
+	}
+	return !p.IsSparse() || len(p.Ranks) > 0 || s.Infer != RanksGiven || s.Tree != nil
+}
+
+// Choose returns Repeat clusters of the population,
+// which must have the ranks to cluster by, see Ranked.
+func (s Sampler) Choose(p Pop) ([][]string, error) {
+	indices, err := s.ChooseIndices(p)
+	if err != nil {
+		return nil, err
+	}
+	clusters := [][]string{}
+	for _, cluster := range indices {
+		clusters = append(clusters, p.genomesAt(cluster))
+	}
+	return clusters, nil
+}
+
+// ChooseIndices returns the genome indices of the clusters of Choose.
+func (s Sampler) ChooseIndices(p Pop) ([][]int, error) {
+	if s.ByRandom {
+		return randChooseIndices(p.NumGenomes(), s.ClusterSize, s.Repeat), nil
+	}
+
+	var clusters [][]int
+	if s.ByClade {
+		tree := s.Tree
+		if tree == nil {
+			var err error
+			tree, err = BuildTree(p, s.Infer, s.Comparer)
+			if err != nil {
+				return nil, err
+			}
+		}
+		var err error
+		clusters, err = chooseCladeIndices(p, tree, s.ClusterSize, s.Repeat)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		clusters, err = biasChooseIndices(p, s.ClusterSize, s.Repeat, s.byCoalTime(p), s.Comparer)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if s.Mix > 0 {
+		mix := s.Mix
+		if mix >= s.ClusterSize {
+			mix = s.ClusterSize - 1
+		}
+		mixes := randChooseIndices(p.NumGenomes(), mix, s.Repeat)
+		for k := 0; k < s.Repeat; k++ {
+			for j := 1; j <= mix; j++ {
+				clusters[k][j] = mixes[k][j-1]
+			}
+		}
+	}
+	return clusters, nil
+}
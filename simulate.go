@@ -0,0 +1,205 @@
+package biascorr
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+)
+
+var nucleotides = []byte{'A', 'T', 'G', 'C'}
+
+// Simulator simulates a haploid Wright-Fisher population with mutation
+// and homologous recombination by fragment transfer.
+type Simulator struct {
+	Size, Length               int
+	MutationRate, TransferRate float64 // per site per generation.
+	FragLen                    int
+	Generations                int
+
+	rng *rand.Rand
+}
+
+// NewSimulator returns a new Simulator.
+func NewSimulator(size, length int, seed int64) *Simulator {
+	s := Simulator{}
+	s.Size = size
+	s.Length = length
+	s.FragLen = 1000
+	s.Generations = 10 * size
+	s.rng = rand.New(rand.NewSource(seed))
+	return &s
+}
+
+// Simulate runs one population forward in time and returns it as a Pop.
+// All genomes start from one random ancestor, so every pair of lineages
+// has coalesced by generation zero at the latest.
+func (s *Simulator) Simulate() Pop {
+	ancestor := make([]byte, s.Length)
+	for i := range ancestor {
+		ancestor[i] = nucleotides[s.rng.Intn(len(nucleotides))]
+	}
+
+	// genomes are shared between individuals until they are modified.
+	genomes := make([][]byte, s.Size)
+	times := make([][]int, s.Size)
+	for i := range genomes {
+		genomes[i] = ancestor
+		times[i] = make([]int, s.Size)
+	}
+
+	parents := make([]int, s.Size)
+	for g := 0; g < s.Generations; g++ {
+		for i := range parents {
+			parents[i] = s.rng.Intn(s.Size)
+		}
+
+		newGenomes := make([][]byte, s.Size)
+		for i, p := range parents {
+			newGenomes[i] = s.evolve(genomes[p], genomes)
+		}
+
+		newTimes := make([][]int, s.Size)
+		for i := range newTimes {
+			newTimes[i] = make([]int, s.Size)
+			for j := range newTimes[i] {
+				if i == j {
+					continue
+				}
+				pi, pj := parents[i], parents[j]
+				if pi == pj {
+					newTimes[i][j] = 1
+				} else {
+					newTimes[i][j] = times[pi][pj] + 1
+				}
+			}
+		}
+
+		genomes = newGenomes
+		times = newTimes
+	}
+
+	p := Pop{}
+	p.Size = s.Size
+	p.Length = s.Length
+	p.MutationRate = s.MutationRate
+	p.TransferRate = s.TransferRate
+	p.FragLen = s.FragLen
+	p.Generation = s.Generations
+	for _, g := range genomes {
+		p.Genomes = append(p.Genomes, string(g))
+	}
+	p.Ranks = coalRanks(times)
+
+	return p
+}
+
+// evolve returns the genome of a child of the parent genome,
+// with transfers from donors in the parental generation and mutations.
+func (s *Simulator) evolve(parent []byte, donors [][]byte) []byte {
+	numTransfers := poisson(s.rng, s.TransferRate*float64(s.Length))
+	numMutations := poisson(s.rng, s.MutationRate*float64(s.Length))
+	if numTransfers == 0 && numMutations == 0 {
+		return parent
+	}
+
+	child := make([]byte, len(parent))
+	copy(child, parent)
+	for k := 0; k < numTransfers; k++ {
+		donor := donors[s.rng.Intn(len(donors))]
+		start := s.rng.Intn(s.Length)
+		for i := 0; i < s.FragLen && i < s.Length; i++ {
+			j := (start + i) % s.Length
+			child[j] = donor[j]
+		}
+	}
+
+	for k := 0; k < numMutations; k++ {
+		pos := s.rng.Intn(s.Length)
+		b := nucleotides[s.rng.Intn(len(nucleotides))]
+		for b == child[pos] {
+			b = nucleotides[s.rng.Intn(len(nucleotides))]
+		}
+		child[pos] = b
+	}
+
+	return child
+}
+
+// coalRanks converts pairwise coalescent times into ranks,
+// where rank 1 is the most recent coalescent event.
+func coalRanks(times [][]int) [][]float64 {
+	depths := make([][]float64, len(times))
+	for i := range times {
+		depths[i] = make([]float64, len(times[i]))
+		for j := range times[i] {
+			depths[i][j] = float64(times[i][j])
+		}
+	}
+	return rankDepths(depths)
+}
+
+// poisson draws a Poisson random number with mean lambda.
+func poisson(rng *rand.Rand, lambda float64) int {
+	if lambda <= 0 {
+		return 0
+	}
+
+	if lambda > 30 {
+		v := math.Floor(lambda + math.Sqrt(lambda)*rng.NormFloat64() + 0.5)
+		if v < 0 {
+			return 0
+		}
+		return int(v)
+	}
+
+	l := math.Exp(-lambda)
+	k := 0
+	p := 1.0
+	for {
+		p *= rng.Float64()
+		if p <= l {
+			return k
+		}
+		k++
+	}
+}
+
+// WritePops writes populations as a stream of JSON records, or in the
+// binary format if the file ends with .bcp, gzipped if it ends with .gz.
+// They can be read back by ReadPops.
+func WritePops(pops chan Pop, file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w io.Writer = f
+	if strings.HasSuffix(file, ".gz") {
+		gz := gzip.NewWriter(f)
+		defer gz.Close()
+		w = gz
+	}
+
+	if strings.HasSuffix(strings.TrimSuffix(file, ".gz"), ".bcp") {
+		bw := NewBinaryPopWriter(w)
+		for p := range pops {
+			if err := bw.Write(p); err != nil {
+				return err
+			}
+		}
+		return bw.Close()
+	}
+
+	encoder := json.NewEncoder(w)
+	for p := range pops {
+		if err := encoder.Encode(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package biascorr
+
+// SiteComparer compares genomes site by site,
+// skipping masked sites and handling missing data.
+// A nil SiteComparer compares raw bytes at every site.
+type SiteComparer struct {
+	Missing MissingPolicy
+	Mask    []bool // Mask[k] is true if site k is excluded.
+	Blocks  []int  // if not nil, lagged pairs are only counted within a block.
+
+	// Partition, if not nil, keeps lagged pairs within its blocks,
+	// which decide circularity instead of the genome.
+	Partition *Partition
+}
+
+// NewSiteComparer returns a new SiteComparer.
+func NewSiteComparer(missing MissingPolicy, mask []bool) *SiteComparer {
+	return &SiteComparer{Missing: missing, Mask: mask}
+}
+
+// Masked returns true if site k is excluded.
+func (s *SiteComparer) Masked(k int) bool {
+	if s == nil {
+		return false
+	}
+	return k < len(s.Mask) && s.Mask[k]
+}
+
+// SameBlock returns true if sites i and j may form a lagged pair.
+func (s *SiteComparer) SameBlock(i, j int) bool {
+	if s == nil || s.Blocks == nil {
+		return true
+	}
+	return i < len(s.Blocks) && j < len(s.Blocks) && s.Blocks[i] == s.Blocks[j]
+}
+
+// Lagged returns the site at lag l from site i of a genome of length sites,
+// and false if the pair is not counted, as it passes the end of a linear
+// genome or block, or joins different blocks.
+func (s *SiteComparer) Lagged(i, l, length int, circular bool) (int, bool) {
+	var j int
+	if s != nil && s.Partition != nil {
+		var ok bool
+		if j, ok = s.Partition.Lagged(i, l); !ok {
+			return 0, false
+		}
+	} else {
+		if !circular && i+l >= length {
+			return 0, false
+		}
+		j = (i + l) % length
+	}
+	return j, j < length && s.SameBlock(i, j)
+}
+
+// LaggedFrom returns the site from which site j is at lag l, see Lagged,
+// and false if there is none.
+func (s *SiteComparer) LaggedFrom(j, l, length int, circular bool) (int, bool) {
+	var i int
+	if s != nil && s.Partition != nil {
+		var ok bool
+		if i, ok = s.Partition.LaggedFrom(j, l); !ok {
+			return 0, false
+		}
+	} else {
+		if !circular && j < l {
+			return 0, false
+		}
+		i = ((j-l)%length + length) % length
+	}
+	return i, i < length && s.SameBlock(i, j)
+}
+
+// Compare compares two genomes site by site.
+// same[k] reports whether site k is identical,
+// and valid[k] whether site k is counted at all.
+func (s *SiteComparer) Compare(a, b string, same, valid []bool) {
+	for k := 0; k < len(a); k++ {
+		same[k] = a[k] == b[k]
+		valid[k] = !s.Masked(k)
+		if s == nil || s.Missing == MissingRaw {
+			continue
+		}
+		if IsMissing(a[k]) || IsMissing(b[k]) {
+			if s.Missing == MissingIgnore {
+				valid[k] = false
+			} else {
+				same[k] = false
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package biascorr
+
+import (
+	"sort"
+	"sync"
+)
+
+// sparseDivergence is the largest fraction of sites at which a genome
+// may differ from the first genome for CalcP2 to use calcP2Sparse.
+const sparseDivergence = 0.01
+
+// sparseComparable returns true if the comparer compares raw bytes,
+// so that calcP2Sparse needs no reference alleles besides the substitutions.
+func sparseComparable(cmp *SiteComparer) bool {
+	return cmp == nil || cmp.Missing == MissingRaw
+}
+
+// isSparse returns true if the genomes differ from the first genome
+// at few enough sites, given their substitutions.
+func isSparse(subsArr []Subs, length int) bool {
+	for _, subs := range subsArr {
+		if float64(len(subs)) > sparseDivergence*float64(length) {
+			return false
+		}
+	}
+	return true
+}
+
+// validPairs returns the number of site pairs of unmasked sites
+// in each lag bin, in closed form if no site is masked and lagged pairs
+// are not kept within blocks.
+func validPairs(length int, bins []LagBin, circular bool, cmp *SiteComparer) []int {
+	valid := make([]int, len(bins))
+	enumerate := cmp != nil && (len(cmp.Mask) > 0 || cmp.Blocks != nil || cmp.Partition != nil)
+	for b, bin := range bins {
+		for l := bin.Lo; l <= bin.Hi; l++ {
+			switch {
+			case enumerate:
+				for i := 0; i < length; i++ {
+					if j, ok := cmp.Lagged(i, l, length, circular); ok && !cmp.Masked(i) && !cmp.Masked(j) {
+						valid[b]++
+					}
+				}
+			case circular:
+				valid[b] += length
+			case l < length:
+				valid[b] += length - l
+			}
+		}
+	}
+	return valid
+}
+
+// pairCache keeps the valid site pairs of calcP2Sparse by genome length,
+// for comparers of the same mask and lag bins. It is safe for concurrent use.
+type pairCache struct {
+	mu    sync.Mutex
+	valid map[int][]int
+}
+
+// get returns the valid site pairs of genomes of length sites.
+func (pc *pairCache) get(length int, bins []LagBin, circular bool, cmp *SiteComparer) []int {
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	if pc.valid == nil {
+		pc.valid = make(map[int][]int)
+	}
+	valid, found := pc.valid[length]
+	if !found {
+		valid = validPairs(length, bins, circular, cmp)
+		pc.valid[length] = valid
+	}
+	return valid
+}
+
+// calcP2Sparse calculates P2 and P0 like calcP2Dense, from the
+// substitutions of each genome relative to a reference, such as the first
+// genome as found by identifySubs, or the reference of a sparse population.
+// Each pair of genomes is reduced to the sorted positions at which they
+// differ, or miss data, so a lag takes time proportional to their number.
+// ref holds the reference alleles at the sites of the substitutions,
+// the other sites being alike, and may be nil if cmp compares raw bytes.
+// The valid site pairs are taken from pairs if it is not nil.
+func calcP2Sparse(subsArr []Subs, ref Subs, length int, bins []LagBin, circular bool, cmp *SiteComparer, pairs *pairCache) (results []Result) {
+	// valid site pairs in each lag bin, which are the same for every genome pair
+	// apart from their missing sites.
+	var valid []int
+	if pairs != nil {
+		valid = pairs.get(length, bins, circular, cmp)
+	} else {
+		valid = validPairs(length, bins, circular, cmp)
+	}
+	refMissing := []int{}
+	for _, s := range ref {
+		if s.Pos < length && IsMissing(s.A) {
+			refMissing = append(refMissing, s.Pos)
+		}
+	}
+	// compared returns true if site k of a pair is counted.
+	invalid := make([]bool, length)
+	compared := func(k int) bool { return !cmp.Masked(k) && !invalid[k] }
+
+	diff := make([]bool, length)
+	pxy := make([]float64, len(bins))
+	p00 := make([]float64, len(bins))
+	sites := make([]int, len(bins))
+	n := 0
+	for i := 0; i < len(subsArr); i++ {
+		for j := i + 1; j < len(subsArr); j++ {
+			positions, missing := pairSites(subsArr[i], subsArr[j], ref, refMissing, cmp)
+			for _, p := range positions {
+				diff[p] = true
+			}
+			for _, p := range missing {
+				invalid[p] = true
+			}
+
+			for b, bin := range bins {
+				// valid site pairs of the genome pair, and the site pairs
+				// differing at both sites, at the first site, and at the second site.
+				pairs := valid[b]
+				both, first, second := 0, 0, 0
+				for l := bin.Lo; l <= bin.Hi; l++ {
+					for _, p := range missing {
+						if q, ok := cmp.Lagged(p, l, length, circular); ok && !cmp.Masked(q) {
+							pairs--
+						}
+						// pairs of two missing sites are removed once, above.
+						if q, ok := cmp.LaggedFrom(p, l, length, circular); ok && compared(q) {
+							pairs--
+						}
+					}
+					for _, p := range positions {
+						if q, ok := cmp.Lagged(p, l, length, circular); ok && compared(q) {
+							first++
+							if diff[q] {
+								both++
+							}
+						}
+						if q, ok := cmp.LaggedFrom(p, l, length, circular); ok && compared(q) {
+							second++
+						}
+					}
+				}
+				pxy[b] += float64(both) / float64(pairs)
+				p00[b] += float64(pairs-first-second+both) / float64(pairs)
+				sites[b] += pairs
+			}
+
+			for _, p := range positions {
+				diff[p] = false
+			}
+			for _, p := range missing {
+				invalid[p] = false
+			}
+			n++
+		}
+	}
+
+	return p2Results(bins, pxy, p00, sites, n)
+}
+
+// pairSites returns the unmasked sites at which two genomes of substitutions
+// against the reference alleles ref differ, and those not compared as either
+// genome misses them, by the missing data policy of cmp, see Compare.
+// refMissing holds the sites whose reference allele is missing.
+func pairSites(a, b, ref Subs, refMissing []int, cmp *SiteComparer) (diff, missing []int) {
+	if sparseComparable(cmp) {
+		for _, s := range removeDuplicateSubs(a, b) {
+			if !cmp.Masked(s.Pos) {
+				diff = append(diff, s.Pos)
+			}
+		}
+		return
+	}
+
+	candidates := append([]int{}, refMissing...)
+	for _, s := range a {
+		candidates = append(candidates, s.Pos)
+	}
+	for _, s := range b {
+		candidates = append(candidates, s.Pos)
+	}
+	sort.Ints(candidates)
+
+	// allele returns the allele of subs at site k, or r,
+	// moving the index i along the sorted sites.
+	allele := func(subs Subs, i *int, k int, r byte) byte {
+		for *i < len(subs) && subs[*i].Pos < k {
+			*i++
+		}
+		if *i < len(subs) && subs[*i].Pos == k {
+			return subs[*i].A
+		}
+		return r
+	}
+	ia, ib, ir := 0, 0, 0
+	for c, k := range candidates {
+		if (c > 0 && k == candidates[c-1]) || cmp.Masked(k) {
+			continue
+		}
+		// sites without a reference allele are alike in every genome.
+		r := allele(ref, &ir, k, 'A')
+		x, y := allele(a, &ia, k, r), allele(b, &ib, k, r)
+		switch {
+		case IsMissing(x) || IsMissing(y):
+			if cmp.Missing == MissingIgnore {
+				missing = append(missing, k)
+			} else {
+				diff = append(diff, k)
+			}
+		case x != y:
+			diff = append(diff, k)
+		}
+	}
+	return
+}
@@ -0,0 +1,208 @@
+package biascorr
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// closeGenomes returns n genomes of the given length,
+// each differing from a random ancestor at about subs sites.
+func closeGenomes(r *rand.Rand, n, length, subs int) []string {
+	ancestor := make([]byte, length)
+	for k := range ancestor {
+		ancestor[k] = nucleotides[r.Intn(len(nucleotides))]
+	}
+	genomes := []string{}
+	for i := 0; i < n; i++ {
+		g := append([]byte{}, ancestor...)
+		for s := 0; s < subs; s++ {
+			g[r.Intn(length)] = nucleotides[r.Intn(len(nucleotides))]
+		}
+		genomes = append(genomes, string(g))
+	}
+	return genomes
+}
+
+func sameResults(a, b []Result) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if math.IsNaN(x.Value) && math.IsNaN(y.Value) {
+			x.Value, y.Value = 0, 0
+		}
+		if x != y {
+			return false
+		}
+	}
+	return true
+}
+
+func TestCalcP2SparseMatchesDense(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	length := 500
+	mask := make([]bool, length)
+	for k := range mask {
+		mask[k] = r.Intn(10) == 0
+	}
+	binSets := map[string][]LagBin{
+		"linear": LinearLags(40),
+		"log":    LogLags(400, 8, true),
+		"long":   {{Lo: 0, Hi: 0}, {Lo: 490, Hi: 520}},
+	}
+
+	comparers := map[string]*SiteComparer{
+		"none":      nil,
+		"masked":    NewSiteComparer(MissingRaw, mask),
+		"blocks":    blockComparer(length, 7),
+		"partition": partitionComparer(t, []int{100, 150, 240}),
+	}
+
+	for trial := 0; trial < 5; trial++ {
+		genomes := closeGenomes(r, 6, length, 3+trial*5)
+		for name, bins := range binSets {
+			for _, circular := range []bool{false, true} {
+				for cname, cmp := range comparers {
+					dense := calcP2Dense(genomes, bins, circular, cmp)
+					sparse := calcP2Sparse(identifySubs(genomes), nil, length, bins, circular, cmp, nil)
+					if !sameResults(dense, sparse) {
+						t.Errorf("trial %d, %s lags, circular %v, %s comparer: sparse results differ from dense ones",
+							trial, name, circular, cname)
+					}
+				}
+			}
+		}
+	}
+}
+
+// blockComparer returns a comparer of sites in blocks of the given size.
+func blockComparer(length, size int) *SiteComparer {
+	cmp := NewSiteComparer(MissingRaw, nil)
+	for k := 0; k < length; k++ {
+		cmp.Blocks = append(cmp.Blocks, k/size)
+	}
+	return cmp
+}
+
+// partitionComparer returns a comparer within circular blocks
+// of the given lengths, leaving the last sites out.
+func partitionComparer(t *testing.T, lengths []int) *SiteComparer {
+	pt, err := PartitionLengths(lengths, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmp := NewSiteComparer(MissingRaw, nil)
+	cmp.Partition = pt
+	return cmp
+}
+
+// missingPop returns a sparse population of n genomes of the given length,
+// with about subs substitutions each, some of which miss data,
+// and reference alleles of which some are missing.
+func missingPop(r *rand.Rand, n, length, subs int) Pop {
+	p := Pop{Size: n, Length: length}
+	ref := make([]byte, length)
+	for k := range ref {
+		ref[k] = 'A'
+	}
+	for k := 0; k < length; k += 1 + r.Intn(10) {
+		ref[k] = nucleotides[r.Intn(len(nucleotides))]
+		if r.Intn(8) == 0 {
+			ref[k] = 'N'
+		}
+		p.Ref = append(p.Ref, Sub{Pos: k, A: ref[k]})
+	}
+	for i := 0; i < n; i++ {
+		sites := map[int]bool{}
+		for s := 0; s < subs; s++ {
+			sites[r.Intn(length)] = true
+		}
+		g := Subs{}
+		for k := 0; k < length; k++ {
+			if !sites[k] {
+				continue
+			}
+			a := nucleotides[r.Intn(len(nucleotides))]
+			if r.Intn(4) == 0 {
+				a = '-'
+			}
+			if a != ref[k] {
+				g = append(g, Sub{Pos: k, A: a})
+			}
+		}
+		p.Subs = append(p.Subs, g)
+	}
+	return p
+}
+
+func TestCalcP2SparseMissing(t *testing.T) {
+	r := rand.New(rand.NewSource(3))
+	length := 300
+	mask := make([]bool, length)
+	for k := range mask {
+		mask[k] = r.Intn(10) == 0
+	}
+	bins := LogLags(250, 6, true)
+
+	for trial := 0; trial < 4; trial++ {
+		p := missingPop(r, 5, length, 5+trial*10)
+		genomes := p.genomesAt([]int{0, 1, 2, 3, 4})
+		for _, policy := range []MissingPolicy{MissingRaw, MissingAsDiff, MissingIgnore} {
+			comparers := map[string]*SiteComparer{
+				"plain":     NewSiteComparer(policy, nil),
+				"masked":    NewSiteComparer(policy, mask),
+				"blocks":    blockComparer(length, 11),
+				"partition": partitionComparer(t, []int{80, 120, 90}),
+			}
+			comparers["blocks"].Missing = policy
+			comparers["partition"].Missing = policy
+			for cname, cmp := range comparers {
+				for _, circular := range []bool{false, true} {
+					dense := calcP2Dense(genomes, bins, circular, cmp)
+					sparse := calcP2Sparse(p.Subs, p.Ref, length, bins, circular, cmp, nil)
+					if !sameResults(dense, sparse) {
+						t.Errorf("trial %d, policy %d, %s comparer, circular %v: sparse %v, want %v",
+							trial, policy, cname, circular, sparse, dense)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestCalcP2ChoosesSparse(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	close := closeGenomes(r, 4, 1000, 5)
+	far := closeGenomes(r, 4, 1000, 200)
+	if !isSparse(identifySubs(close), 1000) {
+		t.Error("closely related genomes are not sparse")
+	}
+	if isSparse(identifySubs(far), 1000) {
+		t.Error("divergent genomes are sparse")
+	}
+	if sparseComparable(NewSiteComparer(MissingIgnore, nil)) {
+		t.Error("ignoring missing data is sparse comparable")
+	}
+}
+
+func TestValidPairs(t *testing.T) {
+	length := 50
+	bins := []LagBin{{0, 0}, {1, 9}, {10, 49}, {50, 60}}
+	unmasked := NewSiteComparer(MissingRaw, make([]bool, length))
+	for _, circular := range []bool{false, true} {
+		// an empty mask counts every pair by brute force.
+		got, want := validPairs(length, bins, circular, nil), validPairs(length, bins, circular, unmasked)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("circular %v: valid pairs %v, want %v", circular, got, want)
+		}
+	}
+
+	pc := &pairCache{}
+	first := pc.get(length, bins, false, nil)
+	if second := pc.get(length, bins, false, nil); &first[0] != &second[0] {
+		t.Error("valid pairs were not cached")
+	}
+}
@@ -0,0 +1,178 @@
+package biascorr
+
+// NumGenomes returns the number of genomes,
+// given as strings or as substitutions.
+func (p Pop) NumGenomes() int {
+	if p.IsSparse() {
+		return len(p.Subs)
+	}
+	return len(p.Genomes)
+}
+
+// IsSparse returns true if the genomes are given as substitutions
+// against a reference instead of strings, see Pop.Subs.
+func (p Pop) IsSparse() bool {
+	return len(p.Genomes) == 0 && len(p.Subs) > 0
+}
+
+// GenomeLength returns the number of sites of the genomes.
+func (p Pop) GenomeLength() int {
+	if p.IsSparse() || len(p.Genomes) == 0 {
+		return p.Length
+	}
+	return len(p.Genomes[0])
+}
+
+// Genome returns genome i as a string. Genomes of sparse populations
+// are built from their substitutions and the reference alleles,
+// with A at the sites without variants, so they only serve comparisons.
+func (p Pop) Genome(i int) string {
+	if !p.IsSparse() {
+		return p.Genomes[i]
+	}
+	g := make([]byte, p.Length)
+	for k := range g {
+		g[k] = 'A'
+	}
+	for _, s := range p.Ref {
+		g[s.Pos] = s.A
+	}
+	for _, s := range p.Subs[i] {
+		g[s.Pos] = s.A
+	}
+	return string(g)
+}
+
+// genomesAt returns the genomes of the indices as strings.
+func (p Pop) genomesAt(indices []int) []string {
+	genomes := []string{}
+	for _, i := range indices {
+		genomes = append(genomes, p.Genome(i))
+	}
+	return genomes
+}
+
+// Cluster returns a population of the genomes of the indices,
+// with the parameters of p but no names or ranks,
+// as genomes may be chosen more than once.
+func (p Pop) Cluster(indices []int) Pop {
+	c := Pop{Size: len(indices), Length: p.GenomeLength()}
+	c.MutationRate, c.TransferRate = p.MutationRate, p.TransferRate
+	c.FragLen, c.Generation = p.FragLen, p.Generation
+	if !p.IsSparse() {
+		c.Genomes = p.genomesAt(indices)
+		return c
+	}
+	c.Ref = p.Ref
+	for _, i := range indices {
+		c.Subs = append(c.Subs, p.Subs[i])
+	}
+	return c
+}
+
+// genomeDistance returns the fraction of compared sites
+// that differ between two genomes of a population.
+func genomeDistance(p Pop, cmp *SiteComparer) func(i, j int) float64 {
+	if !p.IsSparse() {
+		return func(i, j int) float64 {
+			return CompareGenomes(p.Genomes[i], p.Genomes[j], cmp)
+		}
+	}
+
+	sites := 0
+	for k := 0; k < p.Length; k++ {
+		if !cmp.Masked(k) {
+			sites++
+		}
+	}
+	return func(i, j int) float64 {
+		return compareSubs(p.Subs[i], p.Subs[j], sites, cmp)
+	}
+}
+
+// compareSubs returns the fraction of compared sites that differ
+// between two genomes given as sorted substitutions against a reference,
+// of which sites are not masked.
+func compareSubs(a, b Subs, sites int, cmp *SiteComparer) float64 {
+	diffs, invalid := 0, 0
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		// x and y are 0 for the reference allele.
+		var pos int
+		var x, y byte
+		switch {
+		case j >= len(b) || (i < len(a) && a[i].Pos < b[j].Pos):
+			pos, x = a[i].Pos, a[i].A
+			i++
+		case i >= len(a) || b[j].Pos < a[i].Pos:
+			pos, y = b[j].Pos, b[j].A
+			j++
+		default:
+			pos, x, y = a[i].Pos, a[i].A, b[j].A
+			i++
+			j++
+		}
+		if cmp.Masked(pos) {
+			continue
+		}
+
+		same := x == y
+		if cmp != nil && cmp.Missing != MissingRaw && ((x != 0 && IsMissing(x)) || (y != 0 && IsMissing(y))) {
+			if cmp.Missing == MissingIgnore {
+				invalid++
+				continue
+			}
+			same = false
+		}
+		if !same {
+			diffs++
+		}
+	}
+	return float64(diffs) / float64(sites-invalid)
+}
+
+// summarizeSparse fills the site statistics of the summary
+// of a sparse population.
+func summarizeSparse(p Pop, s *PopSummary) {
+	// alleles at each variant site, and how many genomes have them.
+	type site struct {
+		alleles map[byte]bool
+		count   int
+	}
+	sites := make(map[int]*site)
+	missingAt := make(map[int]int)
+	missing := 0
+	for _, subs := range p.Subs {
+		for _, sub := range subs {
+			if IsMissing(sub.A) {
+				missingAt[sub.Pos]++
+				missing++
+				continue
+			}
+			if sites[sub.Pos] == nil {
+				sites[sub.Pos] = &site{alleles: make(map[byte]bool)}
+			}
+			sites[sub.Pos].alleles[sub.A] = true
+			sites[sub.Pos].count++
+		}
+	}
+	// genomes without a substitution at a site have the reference allele.
+	for pos, st := range sites {
+		if len(st.alleles) > 1 || st.count+missingAt[pos] < len(p.Subs) {
+			s.Segregating++
+		}
+	}
+	s.Missing = float64(missing) / float64(s.Length*len(p.Subs))
+
+	distance := genomeDistance(p, nil)
+	pairs := 0
+	for i := 0; i < len(p.Subs); i++ {
+		for j := i + 1; j < len(p.Subs); j++ {
+			s.Diversity += distance(i, j)
+			pairs++
+		}
+	}
+	if pairs > 0 {
+		s.Diversity /= float64(pairs)
+	}
+}
@@ -0,0 +1,218 @@
+package biascorr
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Centroid is a cluster of values in a TDigest.
+type Centroid struct {
+	Mean   float64
+	Weight float64
+}
+
+// TDigest is a mergeable sketch of a distribution for estimating quantiles,
+// following the merging t-digest of Dunning and Ertl.
+type TDigest struct {
+	Compression float64
+	Centroids   []Centroid
+	Count       float64 // total weight.
+	Min, Max    float64
+
+	buffer []Centroid
+}
+
+// NewTDigest returns a new TDigest.
+// Larger compression keeps more centroids and gives more accurate quantiles.
+func NewTDigest(compression float64) *TDigest {
+	return &TDigest{Compression: compression, Min: math.Inf(1), Max: math.Inf(-1)}
+}
+
+// Add adds a value with weight w.
+func (t *TDigest) Add(x, w float64) {
+	if w <= 0 || math.IsNaN(x) {
+		return
+	}
+	t.buffer = append(t.buffer, Centroid{Mean: x, Weight: w})
+	t.Count += w
+	t.Min = math.Min(t.Min, x)
+	t.Max = math.Max(t.Max, x)
+	if float64(len(t.buffer)) > 5*t.Compression {
+		t.compress()
+	}
+}
+
+// Merge adds all values of another TDigest,
+// such as that of another worker or run.
+func (t *TDigest) Merge(t2 *TDigest) {
+	t2.compress()
+	if t2.Count == 0 {
+		return
+	}
+	t.buffer = append(t.buffer, t2.Centroids...)
+	t.Count += t2.Count
+	t.Min = math.Min(t.Min, t2.Min)
+	t.Max = math.Max(t.Max, t2.Max)
+	t.compress()
+}
+
+// MarshalText encodes the digest as its compression, minimum and maximum,
+// followed by the mean:weight of each centroid, separated by spaces.
+func (t *TDigest) MarshalText() ([]byte, error) {
+	t.compress()
+	terms := []string{formatFloat(t.Compression), formatFloat(t.Min), formatFloat(t.Max)}
+	for _, c := range t.Centroids {
+		terms = append(terms, formatFloat(c.Mean)+":"+formatFloat(c.Weight))
+	}
+	return []byte(strings.Join(terms, " ")), nil
+}
+
+// UnmarshalText decodes a digest encoded by MarshalText.
+func (t *TDigest) UnmarshalText(text []byte) error {
+	terms := strings.Fields(string(text))
+	if len(terms) < 3 {
+		return fmt.Errorf("digest %q: expected compression, min and max", text)
+	}
+	d := TDigest{}
+	var err error
+	for i, x := range []*float64{&d.Compression, &d.Min, &d.Max} {
+		if *x, err = strconv.ParseFloat(terms[i], 64); err != nil {
+			return fmt.Errorf("digest: bad number %s", terms[i])
+		}
+	}
+	if d.Compression <= 0 {
+		return fmt.Errorf("digest: compression %g must be positive", d.Compression)
+	}
+	for _, term := range terms[3:] {
+		m, w, ok := strings.Cut(term, ":")
+		c := Centroid{}
+		var err1, err2 error
+		c.Mean, err1 = strconv.ParseFloat(m, 64)
+		c.Weight, err2 = strconv.ParseFloat(w, 64)
+		if !ok || err1 != nil || err2 != nil || c.Weight <= 0 {
+			return fmt.Errorf("digest: bad centroid %s", term)
+		}
+		if n := len(d.Centroids); n > 0 && c.Mean < d.Centroids[n-1].Mean {
+			return fmt.Errorf("digest: centroid %s is not sorted", term)
+		}
+		d.Centroids = append(d.Centroids, c)
+		d.Count += c.Weight
+	}
+	*t = d
+	return nil
+}
+
+// formatFloat formats a float exactly and compactly.
+func formatFloat(x float64) string {
+	return strconv.FormatFloat(x, 'g', -1, 64)
+}
+
+// compress merges buffered values into centroids.
+func (t *TDigest) compress() {
+	if len(t.buffer) == 0 {
+		return
+	}
+
+	all := append(t.Centroids, t.buffer...)
+	sort.Slice(all, func(i, j int) bool { return all[i].Mean < all[j].Mean })
+
+	merged := []Centroid{all[0]}
+	cumulative := 0.0
+	for _, c := range all[1:] {
+		last := &merged[len(merged)-1]
+		w := last.Weight + c.Weight
+		q := (cumulative + w/2) / t.Count
+		if w <= 4*t.Count*q*(1-q)/t.Compression {
+			last.Mean += (c.Mean - last.Mean) * c.Weight / w
+			last.Weight = w
+		} else {
+			cumulative += last.Weight
+			merged = append(merged, c)
+		}
+	}
+
+	t.Centroids = merged
+	t.buffer = nil
+}
+
+// Quantile returns the estimated q-th quantile.
+func (t *TDigest) Quantile(q float64) float64 {
+	t.compress()
+	cs := t.Centroids
+	if len(cs) == 0 {
+		return math.NaN()
+	}
+	if len(cs) == 1 {
+		return cs[0].Mean
+	}
+
+	target := q * t.Count
+	cumulative := 0.0
+	prevCenter, prevMean := 0.0, t.Min
+	for _, c := range cs {
+		center := cumulative + c.Weight/2
+		if target < center {
+			return interpolate(target, prevCenter, center, prevMean, c.Mean)
+		}
+		prevCenter, prevMean = center, c.Mean
+		cumulative += c.Weight
+	}
+	return interpolate(target, prevCenter, t.Count, prevMean, t.Max)
+}
+
+// CDF returns the estimated fraction of values not larger than x.
+func (t *TDigest) CDF(x float64) float64 {
+	t.compress()
+	cs := t.Centroids
+	if len(cs) == 0 {
+		return math.NaN()
+	}
+	if x < t.Min {
+		return 0
+	}
+	if x >= t.Max {
+		return 1
+	}
+
+	cumulative := 0.0
+	prevCenter, prevMean := 0.0, t.Min
+	for _, c := range cs {
+		center := cumulative + c.Weight/2
+		if x < c.Mean {
+			return interpolate(x, prevMean, c.Mean, prevCenter, center) / t.Count
+		}
+		prevCenter, prevMean = center, c.Mean
+		cumulative += c.Weight
+	}
+	return interpolate(x, prevMean, t.Max, prevCenter, t.Count) / t.Count
+}
+
+// Histogram returns the estimated counts of values in nbins
+// equal-width bins between Min and Max.
+func (t *TDigest) Histogram(nbins int) (edges, counts []float64) {
+	if t.Count == 0 || nbins <= 0 {
+		return
+	}
+	width := (t.Max - t.Min) / float64(nbins)
+	prev := 0.0
+	for i := 0; i <= nbins; i++ {
+		edges = append(edges, t.Min+width*float64(i))
+	}
+	for i := 1; i <= nbins; i++ {
+		cdf := t.CDF(edges[i])
+		counts = append(counts, (cdf-prev)*t.Count)
+		prev = cdf
+	}
+	return
+}
+
+// interpolate linearly maps x from [x0, x1] to [y0, y1].
+func interpolate(x, x0, x1, y0, y1 float64) float64 {
+	if x1 == x0 {
+		return (y0 + y1) / 2
+	}
+	return y0 + (x-x0)*(y1-y0)/(x1-x0)
+}
@@ -0,0 +1,126 @@
+package biascorr
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestTDigestSmall(t *testing.T) {
+	// few values keep a centroid each, so estimates are exact.
+	d := NewTDigest(100)
+	for _, x := range []float64{5, 1, 4, 2, 3} {
+		d.Add(x, 1)
+	}
+	if got := d.Quantile(0.5); got != 3 {
+		t.Errorf("median %g, want 3", got)
+	}
+	if got := d.CDF(3); got != 0.5 {
+		t.Errorf("CDF(3) %g, want 0.5", got)
+	}
+	if got, want := d.CDF(0), 0.0; got != want {
+		t.Errorf("CDF(0) %g, want %g", got, want)
+	}
+	if got, want := d.CDF(5), 1.0; got != want {
+		t.Errorf("CDF(5) %g, want %g", got, want)
+	}
+	if got := NewTDigest(100).Quantile(0.5); !math.IsNaN(got) {
+		t.Errorf("median of no values %g, want NaN", got)
+	}
+}
+
+func TestTDigestUniform(t *testing.T) {
+	const n = 10000
+	d := NewTDigest(100)
+	for i := 0; i < n; i++ {
+		// a scrambled order of 0, ..., n-1.
+		d.Add(float64(i*7919%n), 1)
+	}
+	if len(d.Centroids) >= n/10 {
+		t.Errorf("%d centroids for %d values", len(d.Centroids), n)
+	}
+
+	for _, q := range []float64{0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99} {
+		if got, want := d.Quantile(q), q*n; math.Abs(got-want) > 0.005*n {
+			t.Errorf("quantile %g: %g, want %g", q, got, want)
+		}
+		if got := d.CDF(q * n); math.Abs(got-q) > 0.005 {
+			t.Errorf("CDF(%g): %g, want %g", q*n, got, q)
+		}
+	}
+
+	edges, counts := d.Histogram(10)
+	if len(edges) != 11 || len(counts) != 10 || edges[0] != 0 || edges[10] != n-1 {
+		t.Fatalf("edges %v, counts %v", edges, counts)
+	}
+	total := 0.0
+	for i, c := range counts {
+		// exact counts of the integers in each bin, with the first bin closed.
+		want := math.Floor(edges[i+1]) - math.Floor(edges[i])
+		if i == 0 {
+			want++
+		}
+		if math.Abs(c-want) > 0.02*n/10 {
+			t.Errorf("bin %d: count %g, want %g", i, c, want)
+		}
+		total += c
+	}
+	if math.Abs(total-n) > 1e-6 {
+		t.Errorf("histogram total %g, want %d", total, n)
+	}
+}
+
+func TestTDigestMerge(t *testing.T) {
+	// shards of a skewed sample, as of parallel workers or sharded runs.
+	const n = 20000
+	single := NewTDigest(100)
+	shards := []*TDigest{NewTDigest(100), NewTDigest(100), NewTDigest(100)}
+	values := []float64{}
+	for i := 0; i < n; i++ {
+		x := math.Exp(float64(i*7919%n) / n * 4)
+		values = append(values, x)
+		single.Add(x, 1)
+		shards[i%len(shards)].Add(x, 1)
+	}
+	sort.Float64s(values)
+
+	merged := NewTDigest(100)
+	for _, s := range shards {
+		merged.Merge(s)
+	}
+	if merged.Count != single.Count || merged.Min != single.Min || merged.Max != single.Max {
+		t.Fatalf("merged count %g in [%g, %g], want %g in [%g, %g]", merged.Count, merged.Min, merged.Max, single.Count, single.Min, single.Max)
+	}
+	for _, q := range []float64{0.01, 0.1, 0.5, 0.9, 0.99} {
+		exact := values[int(q*n)]
+		got, want := merged.Quantile(q), single.Quantile(q)
+		if math.Abs(got-want) > 0.01*exact || math.Abs(got-exact) > 0.01*exact {
+			t.Errorf("quantile %g: merged %g, single %g, exact %g", q, got, want, exact)
+		}
+	}
+}
+
+func TestTDigestText(t *testing.T) {
+	d := NewTDigest(50)
+	for i := 0; i < 1000; i++ {
+		d.Add(float64(i%37)/3, float64(1+i%3))
+	}
+	text, err := d.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := &TDigest{}
+	if err := got.UnmarshalText(text); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Centroids, d.Centroids) || got.Count != d.Count || got.Min != d.Min || got.Max != d.Max || got.Compression != d.Compression {
+		t.Errorf("decoded %+v, want %+v", got, d)
+	}
+
+	for _, bad := range []string{"", "100 0", "100 0 1 x", "100 0 1 0.5:0", "100 0 1 0.7:1 0.5:1"} {
+		if err := got.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("digest %q was decoded", bad)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package biascorr
+
+import (
+	"math"
+	"sort"
+)
+
+// Params stores the evolutionary parameters of a population.
+type Params struct {
+	Size         int
+	MutationRate float64
+	TransferRate float64
+	FragLen      int
+	Generation   int
+}
+
+// Known returns true if the parameters are those of a simulation,
+// without which there is no neutral expectation, as for VCF or ms input.
+func (p Params) Known() bool {
+	return p.MutationRate > 0
+}
+
+// Params returns the parameters of the population.
+func (p Pop) Params() Params {
+	return Params{
+		Size:         p.Size,
+		MutationRate: p.MutationRate,
+		TransferRate: p.TransferRate,
+		FragLen:      p.FragLen,
+		Generation:   p.Generation,
+	}
+}
+
+// TheoryResult stores a measured correlation and its neutral expectation.
+type TheoryResult struct {
+	Params
+	L int
+	M float64 // measured.
+	E float64 // expected.
+	N int
+	T string
+}
+
+// groupResult is a Result tagged with the parameters of its population,
+// and the lag bin it averages over, whose Lo is Result.Lag.
+type groupResult struct {
+	Params
+	Result
+	Bin LagBin
+}
+
+// ExpectedKs returns the expected pairwise diversity of an unbiased sample.
+func ExpectedKs(par Params) float64 {
+	a := 8.0 * par.MutationRate / 3.0
+	return 0.75 * (1 - coalLaplace(par, a))
+}
+
+// ExpectedP2 returns the expected P2 at lag l of an unbiased sample.
+//
+// Two lineages coalesce after T generations, T being exponential with
+// mean Size and truncated at Generation when it is known. Each site differs
+// with probability p(T) = 3/4 (1 - exp(-8uT/3)) under the Jukes-Cantor model.
+// The two sites at lag l share T until a transfer covers one but not
+// the other, which happens at rate 4 r min(l, FragLen) on the pair;
+// afterwards the second site is treated as independent.
+func ExpectedP2(par Params, l int) float64 {
+	ks := ExpectedKs(par)
+	if l == 0 {
+		return ks
+	}
+
+	a := 8.0 * par.MutationRate / 3.0
+	s := 4.0 * par.TransferRate * math.Min(float64(l), float64(par.FragLen))
+	linked := 9.0 / 16.0 * (coalLaplace(par, s) - 2*coalLaplace(par, s+a) + coalLaplace(par, s+2*a))
+	unlinked := 0.75 * ((1 - coalLaplace(par, a)) - (coalLaplace(par, s) - coalLaplace(par, s+a)))
+	return linked + ks*unlinked
+}
+
+// ExpectedPn returns the expected P2 normalized by Ks at lag l.
+func ExpectedPn(par Params, l int) float64 {
+	return ExpectedP2(par, l) / ExpectedKs(par)
+}
+
+// coalLaplace returns E[exp(-cT)] of the pairwise coalescent time T.
+func coalLaplace(par Params, c float64) float64 {
+	n := float64(par.Size)
+	v := 1 / (1 + c*n)
+	if par.Generation > 0 {
+		g := float64(par.Generation)
+		v += c * n / (1 + c*n) * math.Exp(-(c+1/n)*g)
+	}
+	return v
+}
+
+// collectGroups averages correlation results for each parameter group,
+// and returns the lag bins of the results by their lags.
+func collectGroups(groupChan chan groupResult, weighting string) (map[Params]map[string]map[int]*MeanVar, map[int]LagBin) {
+	groups := make(map[Params]map[string]map[int]*MeanVar)
+	bins := make(map[int]LagBin)
+	for gr := range groupChan {
+		bins[gr.Lag] = gr.Bin
+		resMap, found := groups[gr.Params]
+		if !found {
+			resMap = make(map[string]map[int]*MeanVar)
+			groups[gr.Params] = resMap
+		}
+		res := gr.Result
+		if resMap[res.Type] == nil {
+			resMap[res.Type] = make(map[int]*MeanVar)
+		}
+		if resMap[res.Type][res.Lag] == nil {
+			resMap[res.Type][res.Lag] = NewMeanVar()
+		}
+		if !math.IsNaN(res.Value) {
+			resMap[res.Type][res.Lag].AddWeighted(res.Value, ResultWeight(res, weighting))
+		}
+	}
+
+	return groups, bins
+}
+
+// getTheoryResults pairs measured P2 and Pn with their expectations,
+// averaged over the lags of their bins.
+func getTheoryResults(groups map[Params]map[string]map[int]*MeanVar, bins map[int]LagBin) []TheoryResult {
+	results := []TheoryResult{}
+	for par, resMap := range groups {
+		for t, expect := range map[string]func(Params, int) float64{"P2": ExpectedP2, "Pn": ExpectedPn} {
+			mvs := resMap[t]
+			for _, l := range sortedLags(mvs) {
+				tr := TheoryResult{Params: par, L: l, T: t}
+				tr.M = mvs[l].Mean()
+				tr.N = mvs[l].N
+				bin, found := bins[l]
+				if !found {
+					bin = LagBin{Lo: l, Hi: l}
+				}
+				tr.E = binExpectation(expect, par, bin)
+				results = append(results, tr)
+			}
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Params != b.Params {
+			return lessParams(a.Params, b.Params)
+		}
+		if a.T != b.T {
+			return a.T < b.T
+		}
+		return a.L < b.L
+	})
+
+	return results
+}
+
+// binExpectation returns the mean expectation over the lags of a bin.
+func binExpectation(expect func(Params, int) float64, par Params, bin LagBin) float64 {
+	sum := 0.0
+	for l := bin.Lo; l <= bin.Hi; l++ {
+		sum += expect(par, l)
+	}
+	return sum / float64(bin.Hi-bin.Lo+1)
+}
+
+// lessParams orders parameter groups.
+func lessParams(a, b Params) bool {
+	if a.Size != b.Size {
+		return a.Size < b.Size
+	}
+	if a.MutationRate != b.MutationRate {
+		return a.MutationRate < b.MutationRate
+	}
+	if a.TransferRate != b.TransferRate {
+		return a.TransferRate < b.TransferRate
+	}
+	if a.FragLen != b.FragLen {
+		return a.FragLen < b.FragLen
+	}
+	return a.Generation < b.Generation
+}
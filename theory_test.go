@@ -0,0 +1,28 @@
+package biascorr
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTheoryBinExpectation(t *testing.T) {
+	par := Params{Size: 1000, MutationRate: 1e-4, TransferRate: 1e-4, FragLen: 50, Generation: 0}
+	bin := LagBin{Lo: 10, Hi: 40}
+	groupChan := make(chan groupResult, 1)
+	groupChan <- groupResult{Params: par, Result: Result{Lag: bin.Lo, Type: "P2", Value: 0.1, N: 1}, Bin: bin}
+	close(groupChan)
+
+	groups, bins := collectGroups(groupChan, "none")
+	results := getTheoryResults(groups, bins)
+	if len(results) != 1 {
+		t.Fatalf("%d theory results, want 1", len(results))
+	}
+	want := 0.0
+	for l := bin.Lo; l <= bin.Hi; l++ {
+		want += ExpectedP2(par, l)
+	}
+	want /= float64(bin.Hi - bin.Lo + 1)
+	if got := results[0].E; math.Abs(got-want) > 1e-15 || got == ExpectedP2(par, bin.Lo) {
+		t.Errorf("expectation %g, want the bin mean %g", got, want)
+	}
+}
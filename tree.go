@@ -0,0 +1,193 @@
+package biascorr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// Node is a node of a rooted tree.
+type Node struct {
+	Name     string
+	Length   float64 // branch length to the parent.
+	Children []*Node
+}
+
+// Tree is a rooted tree whose tips stand for genomes.
+type Tree struct {
+	Root *Node
+}
+
+// IsTip returns true if the node has no children.
+func (n *Node) IsTip() bool {
+	return len(n.Children) == 0
+}
+
+// Tips returns the tips in depth-first order.
+func (t *Tree) Tips() []*Node {
+	tips := []*Node{}
+	var walk func(n *Node)
+	walk = func(n *Node) {
+		if n.IsTip() {
+			tips = append(tips, n)
+		}
+		for _, c := range n.Children {
+			walk(c)
+		}
+	}
+	walk(t.Root)
+	return tips
+}
+
+// Ranks returns the coalescent ranks of the genomes of the tips,
+// in the form of Pop.Ranks. The tips are matched by name to names,
+// the names of the genomes, and the rank of a pair orders the depth
+// of their most recent common ancestor, the longest path from it
+// to a tip, where rank 1 is the most recent.
+func (t *Tree) Ranks(names []string) ([][]float64, error) {
+	genome, err := t.matchTips(names)
+	if err != nil {
+		return nil, err
+	}
+	return rankDepths(treeDepths(t.Root, genome, len(names))), nil
+}
+
+// Clades returns the genomes of every clade of exactly size tips,
+// matched by name to names.
+func (t *Tree) Clades(names []string, size int) ([][]int, error) {
+	genome, err := t.matchTips(names)
+	if err != nil {
+		return nil, err
+	}
+	clades := [][]int{}
+	var walk func(n *Node) []int
+	walk = func(n *Node) []int {
+		if n.IsTip() {
+			below := []int{genome[n.Name]}
+			if size == 1 {
+				clades = append(clades, below)
+			}
+			return below
+		}
+		below := []int{}
+		for _, c := range n.Children {
+			below = append(below, walk(c)...)
+		}
+		if len(below) == size {
+			clades = append(clades, below)
+		}
+		return below
+	}
+	walk(t.Root)
+	return clades, nil
+}
+
+// matchTips maps the tip names to genomes, which must match one to one.
+func (t *Tree) matchTips(names []string) (map[string]int, error) {
+	genome := make(map[string]int)
+	for i, name := range names {
+		genome[name] = i
+	}
+	matched := make([]bool, len(names))
+	for _, tip := range t.Tips() {
+		i, found := genome[tip.Name]
+		if !found {
+			return nil, fmt.Errorf("tip %q matches no genome", tip.Name)
+		}
+		if matched[i] {
+			return nil, fmt.Errorf("tip %q appears twice", tip.Name)
+		}
+		matched[i] = true
+	}
+	for i := range matched {
+		if !matched[i] {
+			return nil, fmt.Errorf("genome %s is not a tip", names[i])
+		}
+	}
+	return genome, nil
+}
+
+// treeDepths returns the depths of the most recent common ancestors
+// of pairs of genomes, indexed by tip names.
+func treeDepths(root *Node, genome map[string]int, n int) [][]float64 {
+	depths := make([][]float64, n)
+	for i := range depths {
+		depths[i] = make([]float64, n)
+	}
+	var walk func(node *Node) ([]int, float64)
+	walk = func(node *Node) ([]int, float64) {
+		if node.IsTip() {
+			return []int{genome[node.Name]}, 0
+		}
+		groups := [][]int{}
+		depth := 0.0
+		for _, c := range node.Children {
+			genomes, d := walk(c)
+			if d+c.Length > depth {
+				depth = d + c.Length
+			}
+			groups = append(groups, genomes)
+		}
+		below := []int{}
+		for a := range groups {
+			for b := a + 1; b < len(groups); b++ {
+				for _, i := range groups[a] {
+					for _, j := range groups[b] {
+						depths[i][j] = depth
+						depths[j][i] = depth
+					}
+				}
+			}
+			below = append(below, groups[a]...)
+		}
+		return below, depth
+	}
+	walk(root)
+	return depths
+}
+
+// rankDepths converts pairwise coalescent depths into ranks,
+// where rank 1 is the most recent coalescent event.
+func rankDepths(depths [][]float64) [][]float64 {
+	seen := make(map[float64]bool)
+	for i := range depths {
+		for j := range depths[i] {
+			if i != j {
+				seen[depths[i][j]] = true
+			}
+		}
+	}
+
+	distinct := []float64{}
+	for d := range seen {
+		distinct = append(distinct, d)
+	}
+	sort.Float64s(distinct)
+
+	rankOf := make(map[float64]float64)
+	for i, d := range distinct {
+		rankOf[d] = float64(i + 1)
+	}
+
+	ranks := make([][]float64, len(depths))
+	for i := range depths {
+		ranks[i] = make([]float64, len(depths[i]))
+		for j := range depths[i] {
+			if i != j {
+				ranks[i][j] = rankOf[depths[i][j]]
+			}
+		}
+	}
+
+	return ranks
+}
+
+// indexNames returns the names of n genomes without names,
+// their indices.
+func indexNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = strconv.Itoa(i)
+	}
+	return names
+}
@@ -0,0 +1,197 @@
+package biascorr
+
+import (
+	"reflect"
+	"testing"
+)
+
+// pairRanks returns ranks of n genomes, where pairs have the given ranks
+// and every other pair has rank other.
+func pairRanks(n int, pairs map[[2]int]float64, other float64) [][]float64 {
+	ranks := make([][]float64, n)
+	for i := range ranks {
+		ranks[i] = make([]float64, n)
+		for j := range ranks[i] {
+			if i != j {
+				ranks[i][j] = other
+			}
+		}
+	}
+	for pair, r := range pairs {
+		ranks[pair[0]][pair[1]] = r
+		ranks[pair[1]][pair[0]] = r
+	}
+	return ranks
+}
+
+func TestNewickRanks(t *testing.T) {
+	lengths := pairRanks(5, map[[2]int]float64{{2, 3}: 1, {0, 1}: 2}, 3)
+	tests := []struct {
+		newick string
+		want   [][]float64
+	}{
+		{"((0:1,1:1):2,(2:0.5,3:0.5):0.5,4:1);", lengths},
+		{"(('0':1, '1':1)a:2 [comment], (2:0.5,3:0.5):0.5, 4:1)root;\n", lengths},
+		// a cladogram, whose branches have unit lengths.
+		{"(((0,1),4),(2,3));", pairRanks(5, map[[2]int]float64{{0, 1}: 1, {2, 3}: 1, {0, 4}: 2, {1, 4}: 2}, 3)},
+	}
+	for _, test := range tests {
+		tree, err := ParseNewick(test.newick)
+		if err != nil {
+			t.Errorf("%s: %v", test.newick, err)
+			continue
+		}
+		ranks, err := tree.Ranks(indexNames(5))
+		if err != nil {
+			t.Errorf("%s: %v", test.newick, err)
+			continue
+		}
+		if !reflect.DeepEqual(ranks, test.want) {
+			t.Errorf("%s: ranks %v, want %v", test.newick, ranks, test.want)
+		}
+	}
+
+	for _, s := range []string{"(0,1)", "(0,(1,2);", "(0,1:x);", "(0,,1);", "(0,1);x"} {
+		if _, err := ParseNewick(s); err == nil {
+			t.Errorf("bad tree %q was parsed", s)
+		}
+	}
+
+	tree, _ := ParseNewick("((0,1),(2,2));")
+	if _, err := tree.Ranks(indexNames(3)); err == nil {
+		t.Error("a repeated tip was accepted")
+	}
+	tree, _ = ParseNewick("((0,1),2);")
+	if _, err := tree.Ranks(indexNames(4)); err == nil {
+		t.Error("a genome missing from the tree was accepted")
+	}
+}
+
+func TestUPGMA(t *testing.T) {
+	// twice the coalescent depths of an ultrametric tree.
+	dist := pairRanks(5, map[[2]int]float64{{0, 1}: 2, {2, 3}: 1}, 6)
+	ranks, err := UPGMA(dist).Ranks(indexNames(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pairRanks(5, map[[2]int]float64{{2, 3}: 1, {0, 1}: 2}, 3)
+	if !reflect.DeepEqual(ranks, want) {
+		t.Errorf("ranks %v, want %v", ranks, want)
+	}
+}
+
+func TestNeighborJoining(t *testing.T) {
+	// the path lengths of ((0:1,1:2):1,(2:1,3:3):1), whose midpoint root
+	// puts (0,1) at depth 2, (2,3) at depth 3 and the root at 3.5.
+	dist := [][]float64{
+		{0, 3, 4, 6},
+		{3, 0, 5, 7},
+		{4, 5, 0, 4},
+		{6, 7, 4, 0},
+	}
+	tree := NeighborJoining(dist)
+	if len(tree.Root.Children) != 2 {
+		t.Fatalf("root has %d children", len(tree.Root.Children))
+	}
+	ranks, err := tree.Ranks(indexNames(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pairRanks(4, map[[2]int]float64{{0, 1}: 1, {2, 3}: 2}, 3)
+	if !reflect.DeepEqual(ranks, want) {
+		t.Errorf("ranks %v, want %v", ranks, want)
+	}
+}
+
+func TestWithRanks(t *testing.T) {
+	p := Pop{Size: 4, Length: 8, Genomes: []string{"AAAAAAAA", "AAAAAAAT", "CCCCAAAA", "CCCCAAAG"}}
+	for _, method := range []RankMethod{RanksUPGMA, RanksNJ} {
+		q, err := WithRanks(p, method, nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := pairRanks(4, map[[2]int]float64{{0, 1}: 1, {2, 3}: 1}, 2)
+		if !reflect.DeepEqual(q.Ranks, want) {
+			t.Errorf("%s ranks %v, want %v", RankMethodNames[method], q.Ranks, want)
+		}
+		if err := ValidatePop(q); err != nil {
+			t.Error(err)
+		}
+	}
+
+	given := testPops()[0]
+	q, _ := WithRanks(given, RanksUPGMA, nil, nil)
+	if !reflect.DeepEqual(q.Ranks, given.Ranks) {
+		t.Errorf("given ranks replaced by %v", q.Ranks)
+	}
+	tree, _ := ParseNewick("((0,2),1);")
+	q, err := WithRanks(given, RanksGiven, tree, nil)
+	want := pairRanks(3, map[[2]int]float64{{0, 2}: 1}, 2)
+	if err != nil || !reflect.DeepEqual(q.Ranks, want) {
+		t.Errorf("tree ranks %v, %v, want %v", q.Ranks, err, want)
+	}
+
+	p.Names = []string{"w", "x", "y", "z"}
+	if q, err := WithRanks(p, RanksNJ, nil, nil); err != nil || !reflect.DeepEqual(q.Ranks, pairRanks(4, map[[2]int]float64{{0, 1}: 1, {2, 3}: 1}, 2)) {
+		t.Errorf("ranks of named genomes %v, %v", q.Ranks, err)
+	}
+
+	s := Sampler{ClusterSize: 2, Repeat: 1, ByCoalTime: true}
+	if err := s.Check(p); err == nil {
+		t.Error("clusters by absent ranks were accepted")
+	}
+	s.Infer = RanksNJ
+	if err := s.Check(p); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChooseClades(t *testing.T) {
+	p := Pop{
+		Size: 5, Length: 1,
+		Genomes: []string{"A", "C", "G", "T", "N"},
+		Names:   []string{"a", "c", "g", "t", "n"},
+	}
+	tree, err := ParseNewick("(((a,c),g),(t,n));")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clades, err := tree.Clades(p.GenomeNames(), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]int{{0, 1}, {3, 4}}; !reflect.DeepEqual(clades, want) {
+		t.Errorf("clades %v, want %v", clades, want)
+	}
+
+	clusters, err := ChooseClades(p, tree, 2, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]int)
+	for _, genomes := range clusters {
+		seen[genomes[0]+genomes[1]]++
+	}
+	if len(seen) != 2 || seen["AC"] != 2 || seen["TN"] != 2 {
+		t.Errorf("clusters %v do not use each clade twice", clusters)
+	}
+
+	if _, err := ChooseClades(p, tree, 4, 1); err == nil {
+		t.Error("a missing clade size was accepted")
+	}
+	p.Names = nil
+	if _, err := ChooseClades(p, tree, 2, 1); err == nil {
+		t.Error("tips matched genomes without names")
+	}
+
+	s := Sampler{ClusterSize: 3, Repeat: 2, ByClade: true, Tree: tree}
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	p.Names = []string{"a", "c", "g", "t", "n"}
+	clusters, err = s.Choose(p)
+	if err != nil || len(clusters) != 2 || clusters[0][0]+clusters[0][1]+clusters[0][2] != "ACG" {
+		t.Errorf("Choose = %v, %v", clusters, err)
+	}
+}
@@ -0,0 +1,302 @@
+package biascorr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// vcfMagic starts every VCF file.
+const vcfMagic = "##fileformat=VCF"
+
+// isVCF returns true if the reader starts with a VCF header.
+func isVCF(r *bufio.Reader) bool {
+	magic, err := r.Peek(len(vcfMagic))
+	return err == nil && string(magic) == vcfMagic
+}
+
+// ReadVCF reads the sparse populations of a haploid VCF, one for each
+// chromosome, whose genomes are the samples, see Pop.Subs.
+// Chromosome lengths are taken from ##contig lines, or else length.
+// Sites without a record have the reference allele in every genome.
+// Records that fail filters or whose REF is not a single base are skipped.
+// Genotypes that are missing, heterozygous or call alleles other than
+// single bases are missing (N).
+func ReadVCF(r io.Reader, length int) ([]Pop, error) {
+	vr := newVCFReader(bufio.NewReader(r), length)
+	pops := []Pop{}
+	for {
+		p, err := vr.next()
+		if err == io.EOF {
+			return pops, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		pops = append(pops, p)
+	}
+}
+
+// vcfReader reads a VCF one chromosome at a time.
+type vcfReader struct {
+	r       *bufio.Reader
+	length  int            // length of chromosomes without ##contig lengths.
+	lengths map[string]int // ##contig lengths.
+	samples []string
+	line    int
+	pending *vcfRecord // the first record of the next chromosome.
+	done    map[string]bool
+}
+
+func newVCFReader(r *bufio.Reader, length int) *vcfReader {
+	return &vcfReader{r: r, length: length, lengths: make(map[string]int), done: make(map[string]bool)}
+}
+
+// readLine returns the next line without its line ending.
+func (vr *vcfReader) readLine() (string, error) {
+	s, err := vr.r.ReadString('\n')
+	if err == io.EOF && s != "" {
+		err = nil
+	}
+	vr.line++
+	return strings.TrimRight(s, "\r\n"), err
+}
+
+// header reads the meta lines and the #CHROM line.
+func (vr *vcfReader) header() error {
+	for {
+		s, err := vr.readLine()
+		if err == io.EOF {
+			return fmt.Errorf("vcf: no #CHROM line")
+		}
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(s, "##contig=<") {
+			id, length := "", 0
+			for _, kv := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(s, "##contig=<"), ">"), ",") {
+				switch k, v, _ := strings.Cut(kv, "="); k {
+				case "ID":
+					id = v
+				case "length":
+					length, _ = strconv.Atoi(v)
+				}
+			}
+			if id != "" && length > 0 {
+				vr.lengths[id] = length
+			}
+			continue
+		}
+		if strings.HasPrefix(s, "#CHROM") {
+			fields := strings.Split(s, "\t")
+			if len(fields) < 10 {
+				return fmt.Errorf("vcf line %d: no samples", vr.line)
+			}
+			vr.samples = fields[9:]
+			return nil
+		}
+	}
+}
+
+// next returns the population of the next chromosome, or io.EOF.
+func (vr *vcfReader) next() (Pop, error) {
+	if vr.samples == nil {
+		if err := vr.header(); err != nil {
+			return Pop{}, err
+		}
+	}
+
+	rec := vr.pending
+	vr.pending = nil
+	if rec == nil {
+		var err error
+		if rec, err = vr.record(); err != nil {
+			return Pop{}, err
+		}
+	}
+
+	chrom := rec.fields[0]
+	if vr.done[chrom] {
+		return Pop{}, fmt.Errorf("vcf line %d: records of %s are not together", rec.line, chrom)
+	}
+	vr.done[chrom] = true
+	length := vr.lengths[chrom]
+	if length == 0 {
+		length = vr.length
+	}
+	if length == 0 {
+		return Pop{}, fmt.Errorf("vcf: length of %s is unknown; give the reference length", chrom)
+	}
+
+	p := Pop{Size: len(vr.samples), Length: length, Names: vr.samples}
+	p.Subs = make([]Subs, len(vr.samples))
+	site := vcfSite{pos: -1}
+	for rec != nil {
+		if rec.fields[0] != chrom {
+			vr.pending = rec
+			break
+		}
+		if err := vr.addRecord(&p, rec.fields, &site); err != nil {
+			return Pop{}, fmt.Errorf("vcf line %d: %v", rec.line, err)
+		}
+		var err error
+		if rec, err = vr.record(); err != nil && err != io.EOF {
+			return Pop{}, err
+		}
+	}
+	return p, nil
+}
+
+// vcfRecord is a record of a VCF and its line number.
+type vcfRecord struct {
+	fields []string
+	line   int
+}
+
+// record returns the next record, or nil and io.EOF.
+func (vr *vcfReader) record() (*vcfRecord, error) {
+	for {
+		s, err := vr.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if s == "" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		fields := strings.Split(s, "\t")
+		if len(fields) != 9+len(vr.samples) {
+			return nil, fmt.Errorf("vcf line %d: %d fields for %d samples", vr.line, len(fields), len(vr.samples))
+		}
+		return &vcfRecord{fields: fields, line: vr.line}, nil
+	}
+}
+
+// vcfSite is the 0-based position and the reference allele
+// of the last record added.
+type vcfSite struct {
+	pos int
+	ref byte
+}
+
+// addRecord adds the substitutions of a record to the population,
+// unless the record is skipped. Records at the position of the last one,
+// such as the records of a multiallelic site split by bcftools norm -m-,
+// are merged into its site, see mergeCalls.
+func (vr *vcfReader) addRecord(p *Pop, fields []string, last *vcfSite) error {
+	ref, alt, filter := fields[3], fields[4], fields[6]
+	if len(ref) != 1 || (filter != "PASS" && filter != ".") {
+		return nil
+	}
+	pos, err := strconv.Atoi(fields[1])
+	if err != nil || pos < 1 || pos > p.Length {
+		return fmt.Errorf("position %s beyond the length %d", fields[1], p.Length)
+	}
+	pos--
+	if pos < last.pos {
+		return fmt.Errorf("position %d is not after %d", pos+1, last.pos+1)
+	}
+
+	// alleles holds single bases, and 0 for the unusable ones.
+	alleles := []byte{upper(ref[0])}
+	if alt != "." {
+		for _, a := range strings.Split(alt, ",") {
+			if len(a) == 1 && IsAllowed(a[0]) {
+				alleles = append(alleles, upper(a[0]))
+			} else {
+				alleles = append(alleles, 0)
+			}
+		}
+	}
+	merge := pos == last.pos
+	if merge && alleles[0] != last.ref {
+		return fmt.Errorf("REF %c at position %d differs from REF %c of the previous record", alleles[0], pos+1, last.ref)
+	}
+	*last = vcfSite{pos: pos, ref: alleles[0]}
+	gt := -1
+	for i, f := range strings.Split(fields[8], ":") {
+		if f == "GT" {
+			gt = i
+		}
+	}
+	if gt < 0 {
+		return fmt.Errorf("no GT field")
+	}
+
+	varies := false
+	for i, sample := range fields[9:] {
+		a := byte('N')
+		if k, ok := haploidAllele(strings.Split(sample, ":"), gt); ok && k < len(alleles) && alleles[k] != 0 {
+			a = alleles[k]
+		}
+		subs := p.Subs[i]
+		at := len(subs) > 0 && subs[len(subs)-1].Pos == pos
+		if merge {
+			called := alleles[0]
+			if at {
+				called = subs[len(subs)-1].A
+			}
+			a = mergeCalls(called, a, alleles[0])
+		}
+		switch {
+		case a == alleles[0] && at:
+			subs = subs[:len(subs)-1]
+		case a == alleles[0]:
+		case at:
+			subs[len(subs)-1].A = a
+		default:
+			subs = append(subs, Sub{Pos: pos, A: a})
+		}
+		p.Subs[i] = subs
+		varies = varies || a != alleles[0]
+	}
+	if varies && (len(p.Ref) == 0 || p.Ref[len(p.Ref)-1].Pos != pos) {
+		p.Ref = append(p.Ref, Sub{Pos: pos, A: alleles[0]})
+	}
+	return nil
+}
+
+// mergeCalls returns the call of a genome at a site given by two records:
+// an alternative allele wins over the reference and missing calls,
+// and two different alternative alleles, or a reference and a missing
+// call, are missing.
+func mergeCalls(a, b, ref byte) byte {
+	isAlt := func(x byte) bool { return x != ref && x != 'N' }
+	switch {
+	case a == b:
+		return a
+	case isAlt(a) && isAlt(b):
+		return 'N'
+	case isAlt(a):
+		return a
+	case isAlt(b):
+		return b
+	}
+	return 'N'
+}
+
+// haploidAllele returns the allele index of a haploid genotype,
+// or of a homozygous one, and false if the genotype is missing or mixed.
+func haploidAllele(sample []string, gt int) (int, bool) {
+	if gt >= len(sample) {
+		return 0, false
+	}
+	allele := -1
+	for _, s := range strings.FieldsFunc(sample[gt], func(r rune) bool { return r == '/' || r == '|' }) {
+		k, err := strconv.Atoi(s)
+		if err != nil || (allele >= 0 && k != allele) {
+			return 0, false
+		}
+		allele = k
+	}
+	return allele, allele >= 0
+}
+
+// upper returns the upper case of a letter.
+func upper(b byte) byte {
+	if b >= 'a' && b <= 'z' {
+		return b - 'a' + 'A'
+	}
+	return b
+}
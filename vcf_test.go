@@ -0,0 +1,134 @@
+package biascorr
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testVCF = `##fileformat=VCFv4.2
+##contig=<ID=chr,length=40>
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	a	b	c	d
+chr	3	.	A	G	.	PASS	.	GT	0	1	1	0
+chr	5	.	C	T,G	.	.	.	GT:DP	2:9	0:9	.:0	1/1:9
+chr	7	.	AT	A	.	PASS	.	GT	1	0	0	0
+chr	9	.	G	T	.	LowQual	.	GT	1	1	1	1
+chr	12	.	T	<DEL>	.	PASS	.	GT	0	1	0/1	0
+chr	20	.	g	a	.	PASS	.	GT	1	1	0	0
+other	2	.	A	C	.	PASS	.	GT	1	0	0	0
+`
+
+func TestReadVCF(t *testing.T) {
+	pops, err := ReadVCF(strings.NewReader(testVCF), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pops) != 2 {
+		t.Fatalf("%d populations, want 2", len(pops))
+	}
+
+	p := pops[0]
+	wantSubs := []Subs{
+		{{4, 'G'}, {19, 'A'}},
+		{{2, 'G'}, {11, 'N'}, {19, 'A'}},
+		{{2, 'G'}, {4, 'N'}, {11, 'N'}},
+		{{4, 'T'}},
+	}
+	if !reflect.DeepEqual(p.Subs, wantSubs) {
+		t.Errorf("subs %v, want %v", p.Subs, wantSubs)
+	}
+	wantRef := Subs{{2, 'A'}, {4, 'C'}, {11, 'T'}, {19, 'G'}}
+	if !reflect.DeepEqual(p.Ref, wantRef) {
+		t.Errorf("ref %v, want %v", p.Ref, wantRef)
+	}
+	if p.Length != 40 || p.Size != 4 || !reflect.DeepEqual(p.Names, []string{"a", "b", "c", "d"}) {
+		t.Errorf("length %d, size %d, names %v", p.Length, p.Size, p.Names)
+	}
+	if err := ValidatePop(p); err != nil {
+		t.Error(err)
+	}
+	if q := pops[1]; q.Length != 10 || !reflect.DeepEqual(q.Subs, []Subs{{{1, 'C'}}, nil, nil, nil}) {
+		t.Errorf("second chromosome: length %d, subs %v", q.Length, q.Subs)
+	}
+
+	if _, err := ReadVCF(strings.NewReader(testVCF), 0); err == nil {
+		t.Error("a chromosome of unknown length was read")
+	}
+	unsorted := strings.Replace(testVCF, "chr\t20", "chr\t4", 1)
+	if _, err := ReadVCF(strings.NewReader(unsorted), 10); err == nil || !strings.Contains(err.Error(), "line 9:") {
+		t.Errorf("unsorted records were read, or reported at another line: %v", err)
+	}
+}
+
+func TestReadSplitVCF(t *testing.T) {
+	// a multiallelic site split into one record per allele.
+	split := `##fileformat=VCFv4.2
+#CHROM	POS	ID	REF	ALT	QUAL	FILTER	INFO	FORMAT	a	b	c	d	e
+chr	5	.	C	T	.	PASS	.	GT	1	0	0	.	1
+chr	5	.	C	G	.	PASS	.	GT	0	1	0	.	1
+chr	5	.	C	A	.	PASS	.	GT	0	0	0	.	0
+`
+	pops, err := ReadVCF(strings.NewReader(split), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantSubs := []Subs{{{4, 'T'}}, {{4, 'G'}}, nil, {{4, 'N'}}, {{4, 'N'}}}
+	if p := pops[0]; !reflect.DeepEqual(p.Subs, wantSubs) || !reflect.DeepEqual(p.Ref, Subs{{4, 'C'}}) {
+		t.Errorf("subs %v and ref %v, want %v", p.Subs, p.Ref, wantSubs)
+	}
+
+	conflict := strings.Replace(split, "5\t.\tC\tG", "5\t.\tA\tG", 1)
+	if _, err := ReadVCF(strings.NewReader(conflict), 10); err == nil || !strings.Contains(err.Error(), "line 4:") {
+		t.Errorf("records of different REF at a site were merged: %v", err)
+	}
+}
+
+func TestSparsePop(t *testing.T) {
+	pops, err := ReadVCF(strings.NewReader(testVCF), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pops[0]
+	dense := Pop{Size: p.Size, Length: p.Length}
+	for i := 0; i < p.NumGenomes(); i++ {
+		dense.Genomes = append(dense.Genomes, p.Genome(i))
+	}
+
+	for _, policy := range []MissingPolicy{MissingRaw, MissingAsDiff, MissingIgnore} {
+		cmp := NewSiteComparer(policy, nil)
+		if got, want := DistanceMatrix(p, cmp), DistanceMatrix(dense, cmp); !reflect.DeepEqual(got, want) {
+			t.Errorf("policy %d: distances %v, want %v", policy, got, want)
+		}
+	}
+
+	bins := LinearLags(20)
+	for _, policy := range []MissingPolicy{MissingRaw, MissingAsDiff, MissingIgnore} {
+		for _, circular := range []bool{false, true} {
+			cmp := NewSiteComparer(policy, nil)
+			c := Calculator{Lags: bins, Circular: circular}
+			got := c.clusterCorr(p, []int{0, 1, 2, 3}, classComparer{SiteComparer: cmp, pairs: &pairCache{}})
+			want := calcP2Dense(dense.Genomes, bins, circular, cmp)
+			if !sameResults(got, want) {
+				t.Errorf("policy %d, circular %v: sparse P2 %v, want %v", policy, circular, got, want)
+			}
+		}
+	}
+
+	// without ranks, clusters fall back to differing sites.
+	s := Sampler{ClusterSize: 2, Repeat: 2, ByCoalTime: true}
+	if err := s.Check(p); err != nil {
+		t.Errorf("a population without ranks cannot be clustered: %v", err)
+	} else if clusters, err := s.ChooseIndices(p); err != nil || len(clusters) != 2 {
+		t.Errorf("clusters %v: %v", clusters, err)
+	}
+	if p.Params().Known() {
+		t.Error("a VCF population has simulation parameters")
+	}
+
+	if s, d := SummarizePop(p), SummarizePop(dense); s.Segregating != d.Segregating || s.Diversity != d.Diversity || s.Missing != d.Missing {
+		t.Errorf("summary %+v, want %+v", s, d)
+	}
+	if c := p.Cluster([]int{3, 0}); !reflect.DeepEqual(c.Subs, []Subs{p.Subs[3], p.Subs[0]}) || ValidatePop(c) != nil {
+		t.Errorf("cluster %+v", c)
+	}
+}